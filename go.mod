@@ -1,3 +1,3 @@
 module GolangStudyNotes
 
-go 1.12
+go 1.18
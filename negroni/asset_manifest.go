@@ -0,0 +1,188 @@
+package negroni
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultAssetManifestName 是BuildAssetManifest写出的manifest文件名
+const DefaultAssetManifestName = "manifest.json"
+
+// assetHashLength 是文件名中内容hash的长度
+const assetHashLength = 10
+
+// assetNamePattern 匹配BuildAssetManifest生成的文件名，例如 css/app.3f2a1c9d0e.css
+var assetNamePattern = regexp.MustCompile(`^(.*)\.[0-9a-f]{` + strconv.Itoa(assetHashLength) + `}((?:\.[^./]+)?)$`)
+
+// AssetManifest 是逻辑路径到带hash的路径的映射，例如 "css/app.css": "css/app.3f2a1c9d0e.css"，
+// 路径都以/分隔并且不以/开头
+type AssetManifest map[string]string
+
+// ReadAssetManifest 读取BuildAssetManifest写出的manifest文件
+func ReadAssetManifest(file string) (AssetManifest, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var m AssetManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// URL 返回name带hash的URL，prefix是Static的Prefix。
+// name不在manifest中时原样返回，这样开发时不需要先生成manifest
+func (m AssetManifest) URL(prefix, name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if fingerprinted, ok := m[name]; ok {
+		name = fingerprinted
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + name
+}
+
+// FuncMap 返回html/template中使用的函数，例如 <link href="{{asset "css/app.css"}}">
+func (m AssetManifest) FuncMap(prefix string) template.FuncMap {
+	return template.FuncMap{
+		"asset": func(name string) string { return m.URL(prefix, name) },
+	}
+}
+
+// Contains 返回name是否是manifest中带hash的路径
+func (m AssetManifest) Contains(name string) bool {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	match := assetNamePattern.FindStringSubmatch(name)
+	if match == nil {
+		return false
+	}
+	return m[match[1]+match[2]] == name
+}
+
+// BuildAssetManifest 遍历src中的文件，把原文件和带内容hash的副本写入dst，
+// 并在dst中写出manifest.json。以.开头的文件和目录会被跳过。
+// 预压缩文件(例如app.js.gz)使用原文件的hash命名，这样Static仍然能找到它们
+func BuildAssetManifest(src, dst string) (AssetManifest, error) {
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if abs, _ := filepath.Abs(file); abs == absDst {
+			return filepath.SkipDir
+		}
+		if file != src && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			rel, err := filepath.Rel(src, file)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 先处理普通文件，预压缩文件需要用到原文件的hash
+	sort.SliceStable(files, func(i, j int) bool {
+		return encodedAssetBase(files[i]) == "" && encodedAssetBase(files[j]) != ""
+	})
+
+	m := make(AssetManifest)
+	for _, name := range files {
+		from := filepath.Join(src, filepath.FromSlash(name))
+		var fingerprinted string
+		if base := encodedAssetBase(name); base != "" && m[base] != "" {
+			fingerprinted = m[base] + strings.TrimPrefix(name, base)
+		} else {
+			hash, err := hashAssetFile(from)
+			if err != nil {
+				return nil, err
+			}
+			ext := path.Ext(name)
+			fingerprinted = strings.TrimSuffix(name, ext) + "." + hash + ext
+		}
+		m[name] = fingerprinted
+
+		for _, target := range []string{name, fingerprinted} {
+			if err := copyAssetFile(from, filepath.Join(dst, filepath.FromSlash(target))); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dst, DefaultAssetManifestName), append(data, '\n'), 0644); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// encodedAssetBase 返回预压缩文件对应的原文件名，name不是预压缩文件时返回空
+func encodedAssetBase(name string) string {
+	for _, enc := range DefaultStaticEncodings {
+		if strings.HasSuffix(name, enc.Ext) && len(name) > len(enc.Ext) {
+			return strings.TrimSuffix(name, enc.Ext)
+		}
+	}
+	return ""
+}
+
+// hashAssetFile 返回文件内容hash的前assetHashLength个十六进制字符
+func hashAssetFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil))[:assetHashLength], nil
+}
+
+func copyAssetFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
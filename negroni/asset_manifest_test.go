@@ -0,0 +1,89 @@
+package negroni
+
+import (
+	"bytes"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildAssetManifest(t *testing.T) {
+	js := "console.log(1)"
+	src := newStaticDir(t, map[string]string{
+		"index.html":   "<h1>home</h1>",
+		"css/app.css":  "body{}",
+		"js/app.js":    js,
+		"js/app.js.gz": gzipString(t, js),
+		".env":         "SECRET=1",
+		".git/config":  "[core]",
+	})
+	defer os.RemoveAll(src)
+	dst := filepath.Join(src, "dist")
+
+	m, err := BuildAssetManifest(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, len(m), 4)
+	css := m["css/app.css"]
+	expect(t, assetNamePattern.MatchString(css), true)
+	expect(t, IsFingerprinted(css), true)
+	expect(t, m["js/app.js.gz"], m["js/app.js"]+".gz")
+
+	data, _ := ioutil.ReadFile(filepath.Join(dst, filepath.FromSlash(css)))
+	expect(t, string(data), "body{}")
+	data, _ = ioutil.ReadFile(filepath.Join(dst, "css", "app.css"))
+	expect(t, string(data), "body{}")
+	_, err = os.Stat(filepath.Join(dst, ".env"))
+	expect(t, os.IsNotExist(err), true)
+
+	read, err := ReadAssetManifest(filepath.Join(dst, DefaultAssetManifestName))
+	expect(t, err, nil)
+	expect(t, read["css/app.css"], css)
+
+	// 内容不变时名称稳定，再次生成不会把dst自己包含进来
+	again, err := BuildAssetManifest(src, dst)
+	expect(t, err, nil)
+	expect(t, again["css/app.css"], css)
+	expect(t, len(again), 4)
+}
+
+func TestAssetManifestURL(t *testing.T) {
+	m := AssetManifest{"css/app.css": "css/app.0123456789.css"}
+	expect(t, m.URL("", "css/app.css"), "/css/app.0123456789.css")
+	expect(t, m.URL("/static/", "/css/app.css"), "/static/css/app.0123456789.css")
+	expect(t, m.URL("/static", "img/logo.png"), "/static/img/logo.png")
+
+	expect(t, m.Contains("/css/app.0123456789.css"), true)
+	expect(t, m.Contains("/css/app.css"), false)
+	expect(t, m.Contains("/css/app.9876543210.css"), false)
+
+	tpl := template.Must(template.New("page").Funcs(m.FuncMap("/static")).Parse(`<link href="{{asset "css/app.css"}}">`))
+	var buff bytes.Buffer
+	expect(t, tpl.Execute(&buff, nil), nil)
+	expect(t, buff.String(), `<link href="/static/css/app.0123456789.css">`)
+}
+
+func TestStaticManifestCaching(t *testing.T) {
+	src := newStaticDir(t, map[string]string{"css/app.css": "body{}", "robots.txt": "ok"})
+	defer os.RemoveAll(src)
+	dst := filepath.Join(src, "dist")
+	m, err := BuildAssetManifest(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStatic(http.Dir(dst))
+	s.Manifest = m
+	recorder := serveStatic(s, httptest.NewRequest("GET", m.URL("", "css/app.css"), nil))
+	expect(t, recorder.Body.String(), "body{}")
+	expect(t, recorder.Header().Get("Cache-Control"), "public, max-age=31536000, immutable")
+
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/css/app.css", nil))
+	expect(t, recorder.Body.String(), "body{}")
+	expect(t, recorder.Header().Get("Cache-Control"), "")
+}
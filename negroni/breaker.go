@@ -0,0 +1,192 @@
+package negroni
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PanicBreaker 是Recovery使用的按路由熔断器。
+// 一个路由在Window时间内panic达到Threshold次后会被熔断Cooldown时长，
+// 熔断期间该路由的请求直接返回503，同一指纹的堆栈也只记录一次
+type PanicBreaker struct {
+	// Threshold 是触发熔断的panic次数
+	Threshold int
+	// Window 是统计panic次数的时间窗口
+	Window time.Duration
+	// Cooldown 是熔断持续的时长
+	Cooldown time.Duration
+	// KeyFunc 返回请求对应的路由key，默认是DefaultBreakerKey
+	KeyFunc func(r *http.Request) string
+
+	mutex  sync.Mutex
+	routes map[string]*breakerRoute
+	now    func() time.Time
+}
+
+type breakerRoute struct {
+	panics    []time.Time
+	openUntil time.Time
+	sampled   map[string]bool
+}
+
+// NewPanicBreaker 返回一个新的PanicBreaker实例
+func NewPanicBreaker(threshold int, window, cooldown time.Duration) *PanicBreaker {
+	return &PanicBreaker{
+		Threshold: threshold,
+		Window:    window,
+		Cooldown:  cooldown,
+		KeyFunc:   DefaultBreakerKey,
+	}
+}
+
+// DefaultBreakerKey 使用请求的method和路径模式作为路由key。
+// 路径中像ID的段会被替换成":id"，例如 GET /items/42 和 GET /items/43 的key都是 "GET /items/:id"，
+// 这样带参数的路由作为一个整体熔断。能识别的ID是纯数字、UUID和至少16位的十六进制串，
+// 其他形式的参数(例如slug)需要通过KeyFunc返回路由模式
+func DefaultBreakerKey(r *http.Request) string {
+	if r == nil || r.URL == nil {
+		return ""
+	}
+	segments := strings.Split(r.URL.Path, "/")
+	for i, segment := range segments {
+		if isRouteParam(segment) {
+			segments[i] = ":id"
+		}
+	}
+	return r.Method + " " + strings.Join(segments, "/")
+}
+
+// uuidPattern 匹配 8-4-4-4-12 格式的UUID
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// isRouteParam 返回路径中的一段是否像是ID
+func isRouteParam(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	digits, hex := true, true
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		switch {
+		case c >= '0' && c <= '9':
+		case c >= 'a' && c <= 'f', c >= 'A' && c <= 'F':
+			digits = false
+		default:
+			digits, hex = false, false
+		}
+	}
+	return digits || hex && len(segment) >= 16 || uuidPattern.MatchString(segment)
+}
+
+func (b *PanicBreaker) key(r *http.Request) string {
+	if b.KeyFunc == nil {
+		return DefaultBreakerKey(r)
+	}
+	return b.KeyFunc(r)
+}
+
+func (b *PanicBreaker) clock() time.Time {
+	if b.now == nil {
+		return time.Now()
+	}
+	return b.now()
+}
+
+// lookup 返回key对应的状态，没有记录或记录已经过期时返回nil，过期的记录会被删除
+// 调用者必须持有锁
+func (b *PanicBreaker) lookup(key string, now time.Time) *breakerRoute {
+	route, ok := b.routes[key]
+	if !ok {
+		return nil
+	}
+	if b.expired(route, now) {
+		delete(b.routes, key)
+		return nil
+	}
+	return route
+}
+
+// expired 返回路由的熔断是否已经结束，或者窗口内已经没有panic记录
+func (b *PanicBreaker) expired(route *breakerRoute, now time.Time) bool {
+	if !route.openUntil.IsZero() {
+		return !now.Before(route.openUntil)
+	}
+	return len(route.panics) == 0 || now.Sub(route.panics[len(route.panics)-1]) >= b.Window
+}
+
+// Open 返回请求所在路由是否处于熔断状态，以及还需要等待的时间
+// Open 只查询状态，不会为没有panic过的路由保存记录
+func (b *PanicBreaker) Open(r *http.Request) (bool, time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.clock()
+	route := b.lookup(b.key(r), now)
+	if route == nil || route.openUntil.IsZero() {
+		return false, 0
+	}
+	return true, route.openUntil.Sub(now)
+}
+
+// RecordPanic 记录请求所在路由发生了一次panic，达到阈值时开启熔断
+// 同时删除所有已经过期的路由记录，记录的数量不会超过近期发生过panic的路由数
+func (b *PanicBreaker) RecordPanic(r *http.Request) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.clock()
+	for key, route := range b.routes {
+		if b.expired(route, now) {
+			delete(b.routes, key)
+		}
+	}
+
+	key := b.key(r)
+	route := b.lookup(key, now)
+	if route == nil {
+		if b.routes == nil {
+			b.routes = make(map[string]*breakerRoute)
+		}
+		route = &breakerRoute{}
+		b.routes[key] = route
+	}
+	if !route.openUntil.IsZero() {
+		return
+	}
+
+	// 丢弃窗口之外的记录
+	recent := route.panics[:0]
+	for _, t := range route.panics {
+		if now.Sub(t) < b.Window {
+			recent = append(recent, t)
+		}
+	}
+	route.panics = append(recent, now)
+	if len(route.panics) >= b.Threshold {
+		route.openUntil = now.Add(b.Cooldown)
+		route.panics = nil
+	}
+}
+
+// SampleStack 返回是否应该记录这个堆栈。
+// 路由未熔断时总是返回true，熔断期间每个指纹只返回一次true
+func (b *PanicBreaker) SampleStack(r *http.Request, fingerprint string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	route := b.lookup(b.key(r), b.clock())
+	if route == nil || route.openUntil.IsZero() {
+		return true
+	}
+	if route.sampled == nil {
+		route.sampled = make(map[string]bool)
+	}
+	if route.sampled[fingerprint] {
+		return false
+	}
+	route.sampled[fingerprint] = true
+	return true
+}
@@ -0,0 +1,160 @@
+package negroni
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPanicBreaker(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewPanicBreaker(2, time.Minute, 30*time.Second)
+	b.now = func() time.Time { return now }
+
+	req, _ := http.NewRequest("GET", "http://localhost:3000/boom", nil)
+	other, _ := http.NewRequest("POST", "http://localhost:3000/boom", nil)
+
+	b.RecordPanic(req)
+	open, _ := b.Open(req)
+	expect(t, open, false)
+
+	// 窗口之外的panic不计数
+	now = now.Add(2 * time.Minute)
+	b.RecordPanic(req)
+	open, _ = b.Open(req)
+	expect(t, open, false)
+
+	now = now.Add(time.Second)
+	b.RecordPanic(req)
+	open, wait := b.Open(req)
+	expect(t, open, true)
+	expect(t, wait, 30*time.Second)
+
+	open, _ = b.Open(other)
+	expect(t, open, false)
+
+	expect(t, b.SampleStack(req, "a"), true)
+	expect(t, b.SampleStack(req, "a"), false)
+	expect(t, b.SampleStack(req, "b"), true)
+
+	now = now.Add(30 * time.Second)
+	open, _ = b.Open(req)
+	expect(t, open, false)
+	expect(t, b.SampleStack(req, "a"), true)
+}
+
+func TestPanicBreakerBoundedRoutes(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewPanicBreaker(2, time.Minute, 30*time.Second)
+	b.now = func() time.Time { return now }
+
+	// 只查询状态的请求不会留下记录
+	for i := 0; i < 1000; i++ {
+		req, _ := http.NewRequest("GET", "http://localhost:3000/items/"+strconv.Itoa(i), nil)
+		b.Open(req)
+		b.SampleStack(req, "a")
+	}
+	expect(t, len(b.routes), 0)
+
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequest("GET", "http://localhost:3000/route"+strconv.Itoa(i), nil)
+		b.RecordPanic(req)
+	}
+	expect(t, len(b.routes), 10)
+
+	// 窗口过期后的panic会清理旧记录
+	now = now.Add(2 * time.Minute)
+	req, _ := http.NewRequest("GET", "http://localhost:3000/boom", nil)
+	b.RecordPanic(req)
+	b.RecordPanic(req)
+	expect(t, len(b.routes), 1)
+
+	// 熔断结束后查询会删除记录
+	now = now.Add(30 * time.Second)
+	open, _ := b.Open(req)
+	expect(t, open, false)
+	expect(t, len(b.routes), 0)
+}
+
+func TestDefaultBreakerKey(t *testing.T) {
+	for target, key := range map[string]string{
+		"/items/42":            "GET /items/:id",
+		"/items/43/comments/7": "GET /items/:id/comments/:id",
+		"/users/3f2a1c9d-0e4b-4a5c-9d8e-7f6a5b4c3d2e":    "GET /users/:id",
+		"/objects/5d41402abc4b2a76b9719d911017c592/meta": "GET /objects/:id/meta",
+		"/items/":        "GET /items/",
+		"/items/cafe":    "GET /items/cafe",
+		"/posts/hello-1": "GET /posts/hello-1",
+	} {
+		req, _ := http.NewRequest("GET", "http://localhost:3000"+target, nil)
+		expect(t, DefaultBreakerKey(req), key)
+	}
+
+	// 每个ID都panic的参数化路由作为一个整体熔断
+	b := NewPanicBreaker(2, time.Minute, 30*time.Second)
+	for _, id := range []string{"1", "2"} {
+		req, _ := http.NewRequest("GET", "http://localhost:3000/items/"+id, nil)
+		b.RecordPanic(req)
+	}
+	req, _ := http.NewRequest("GET", "http://localhost:3000/items/3", nil)
+	open, _ := b.Open(req)
+	expect(t, open, true)
+}
+
+func TestRecoveryBreaker(t *testing.T) {
+	var buff bytes.Buffer
+	calls := 0
+	rec := NewRecovery()
+	rec.Logger = log.New(&buff, "", 0)
+	rec.PrintStack = false
+	rec.Breaker = NewPanicBreaker(2, time.Minute, time.Minute)
+
+	n := New()
+	n.Use(rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		calls++
+		panic("always")
+	}))
+
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000/always", nil)
+		n.ServeHTTP(recorder, req)
+		expect(t, recorder.Code, http.StatusInternalServerError)
+	}
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/always", nil)
+	n.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusServiceUnavailable)
+	expect(t, recorder.Header().Get("Retry-After"), "60")
+	expect(t, calls, 2)
+	expect(t, strings.Count(buff.String(), "PANIC: always\n"), 2)
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/other", nil)
+	n.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusInternalServerError)
+}
+
+func TestRecoveryBreakerThrottlesStack(t *testing.T) {
+	var buff bytes.Buffer
+	rec := NewRecovery()
+	rec.Logger = log.New(&buff, "", 0)
+	rec.Breaker = NewPanicBreaker(1, time.Minute, time.Minute)
+
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	rec.Breaker.RecordPanic(req)
+
+	stack := []byte(sampleStack)
+	for i := 0; i < 3; i++ {
+		rec.reportPanic(&PanicInformation{RecoveredPanic: "in flight", Request: req}, stack)
+	}
+	expect(t, strings.Count(buff.String(), "PANIC: in flight\n"), 1)
+	expect(t, strings.Count(buff.String(), "stack suppressed, breaker open for GET /"), 2)
+}
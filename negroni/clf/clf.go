@@ -0,0 +1,253 @@
+// Package clf 解析NCSA Common和Combined Log Format格式的访问日志，
+// 可以读取negroni.CommonLogFormatter和negroni.CombinedLogFormatter输出的日志
+package clf
+
+import (
+	"GolangStudyNotes/negroni"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMalformed 表示日志行不是合法的Common或Combined Log Format
+var ErrMalformed = errors.New("clf: malformed log line")
+
+// Record 是一行访问日志的内容
+type Record struct {
+	RemoteAddr string
+	Ident      string
+	User       string
+	Time       time.Time
+	// Request 是原始的请求行，例如 "GET /index.html HTTP/1.1"
+	Request    string
+	Method     string
+	RequestURI string
+	Proto      string
+	Status     int
+	// Size 是response body的字节数，日志中为"-"时是0
+	Size int
+	// Combined 表示这一行是否包含referer和user agent
+	Combined  bool
+	Referer   string
+	UserAgent string
+}
+
+// Parse 解析一行Common或Combined Log Format格式的日志
+func Parse(line string) (*Record, error) {
+	p := &parser{s: strings.TrimRight(line, "\r\n")}
+	rec := &Record{}
+
+	var err error
+	fields := []*string{&rec.RemoteAddr, &rec.Ident, &rec.User}
+	for _, field := range fields {
+		if *field, err = p.word(); err != nil {
+			return nil, err
+		}
+	}
+	date, err := p.bracketed()
+	if err != nil {
+		return nil, err
+	}
+	if rec.Time, err = time.Parse(negroni.CLFDateFormat, date); err != nil {
+		return nil, fmt.Errorf("%v: %v", ErrMalformed, err)
+	}
+	if rec.Request, err = p.quoted(); err != nil {
+		return nil, err
+	}
+	status, err := p.word()
+	if err != nil {
+		return nil, err
+	}
+	if rec.Status, err = strconv.Atoi(status); err != nil {
+		return nil, fmt.Errorf("%v: bad status %q", ErrMalformed, status)
+	}
+	size, err := p.word()
+	if err != nil {
+		return nil, err
+	}
+	if size != "-" {
+		if rec.Size, err = strconv.Atoi(size); err != nil {
+			return nil, fmt.Errorf("%v: bad size %q", ErrMalformed, size)
+		}
+	}
+
+	if !p.done() {
+		rec.Combined = true
+		if rec.Referer, err = p.quoted(); err != nil {
+			return nil, err
+		}
+		if rec.UserAgent, err = p.quoted(); err != nil {
+			return nil, err
+		}
+		if !p.done() {
+			return nil, fmt.Errorf("%v: unexpected trailing data", ErrMalformed)
+		}
+	}
+
+	for _, field := range []*string{&rec.RemoteAddr, &rec.Ident, &rec.User, &rec.Referer, &rec.UserAgent} {
+		if *field == "-" {
+			*field = ""
+		}
+	}
+	parts := strings.SplitN(rec.Request, " ", 3)
+	if len(parts) == 3 {
+		rec.Method, rec.RequestURI, rec.Proto = parts[0], parts[1], parts[2]
+	}
+	return rec, nil
+}
+
+// LoggerEntry 把Record转换为negroni.LoggerEntry，Request中只有能从日志中还原的信息
+func (rec *Record) LoggerEntry() negroni.LoggerEntry {
+	entry := negroni.LoggerEntry{
+		Start:      rec.Time,
+		StartTime:  rec.Time.Format(negroni.LoggerDefaultDateFormat),
+		Status:     rec.Status,
+		Method:     rec.Method,
+		Size:       rec.Size,
+		RemoteAddr: rec.RemoteAddr,
+		User:       rec.User,
+		Referer:    rec.Referer,
+		UserAgent:  rec.UserAgent,
+		Proto:      rec.Proto,
+	}
+	if u, err := url.ParseRequestURI(rec.RequestURI); err == nil {
+		entry.Path = u.Path
+		entry.HostName = u.Host
+		entry.Request = &http.Request{
+			Method:     rec.Method,
+			URL:        u,
+			Proto:      rec.Proto,
+			RequestURI: rec.RequestURI,
+			Header:     http.Header{},
+			RemoteAddr: rec.RemoteAddr,
+		}
+		if rec.Referer != "" {
+			entry.Request.Header.Set("Referer", rec.Referer)
+		}
+		if rec.UserAgent != "" {
+			entry.Request.Header.Set("User-Agent", rec.UserAgent)
+		}
+	}
+	return entry
+}
+
+// Reader 逐行读取访问日志
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewReader 返回一个从r中读取日志的Reader
+func NewReader(r io.Reader) *Reader {
+	return &Reader{scanner: bufio.NewScanner(r)}
+}
+
+// Read 返回下一条记录，跳过空行，读完时返回io.EOF
+// 解析失败的错误中包含行号，调用者可以选择跳过继续读取
+func (r *Reader) Read() (*Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := r.scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rec, err := Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", r.line, err)
+		}
+		return rec, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// parser 是一个简单的从左到右的日志行解析器
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// word 读取下一个以空格分隔的字段
+func (p *parser) word() (string, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] != ' ' {
+		p.pos++
+	}
+	if start == p.pos {
+		return "", ErrMalformed
+	}
+	return p.s[start:p.pos], nil
+}
+
+// bracketed 读取 [...] 中的内容
+func (p *parser) bracketed() (string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) || p.s[p.pos] != '[' {
+		return "", ErrMalformed
+	}
+	end := strings.IndexByte(p.s[p.pos:], ']')
+	if end < 0 {
+		return "", ErrMalformed
+	}
+	value := p.s[p.pos+1 : p.pos+end]
+	p.pos += end + 1
+	return value, nil
+}
+
+// unescapedControls 是Apache用字母转义的控制字符
+var unescapedControls = map[byte]byte{'b': '\b', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v'}
+
+// quoted 读取 "..." 中的内容，并还原Apache的 \" \\ \b \n \r \t \v \xhh 转义
+func (p *parser) quoted() (string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) || p.s[p.pos] != '"' {
+		return "", ErrMalformed
+	}
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return b.String(), nil
+		case c == '\\' && p.pos+1 < len(p.s):
+			next := p.s[p.pos+1]
+			if next == 'x' && p.pos+3 < len(p.s) {
+				if v, err := strconv.ParseUint(p.s[p.pos+2:p.pos+4], 16, 8); err == nil {
+					b.WriteByte(byte(v))
+					p.pos += 4
+					continue
+				}
+			}
+			if control, ok := unescapedControls[next]; ok {
+				next = control
+			}
+			b.WriteByte(next)
+			p.pos += 2
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", ErrMalformed
+}
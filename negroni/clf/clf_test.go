@@ -0,0 +1,137 @@
+package clf
+
+import (
+	"GolangStudyNotes/negroni"
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCommon(t *testing.T) {
+	rec, err := Parse(`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.RemoteAddr != "127.0.0.1" || rec.Ident != "" || rec.User != "frank" {
+		t.Errorf("unexpected client fields: %+v", rec)
+	}
+	if !rec.Time.Equal(time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC)) {
+		t.Errorf("unexpected time: %v", rec.Time)
+	}
+	if rec.Method != "GET" || rec.RequestURI != "/apache_pb.gif" || rec.Proto != "HTTP/1.0" {
+		t.Errorf("unexpected request: %+v", rec)
+	}
+	if rec.Status != 200 || rec.Size != 2326 || rec.Combined {
+		t.Errorf("unexpected response: %+v", rec)
+	}
+}
+
+func TestParseCombined(t *testing.T) {
+	rec, err := Parse(`- - - [10/Oct/2000:13:55:36 -0700] "GET /a\"b HTTP/1.1" 404 - "-" "agent \\ \x0a"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.RemoteAddr != "" || rec.User != "" || rec.Size != 0 || !rec.Combined {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+	if rec.RequestURI != `/a"b` || rec.Referer != "" || rec.UserAgent != "agent \\ \n" {
+		t.Errorf("unexpected unescaping: %+v", rec)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, line := range []string{
+		"",
+		`127.0.0.1 - - 10/Oct/2000 "GET / HTTP/1.0" 200 1`,
+		`127.0.0.1 - - [bad date] "GET / HTTP/1.0" 200 1`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0 200 1`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" ok 1`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200 1 "-" "ua" extra`,
+	} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("expected an error for %q", line)
+		}
+	}
+}
+
+// 用negroni的Logger写日志，再用Reader读回来
+func TestParseControlEscapes(t *testing.T) {
+	rec, err := Parse(`- - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 200 - "-" "a\tb\nc\b\r\v\x01"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.UserAgent != "a\tb\nc\b\r\v\x01" {
+		t.Errorf("unexpected unescaping: %q", rec.UserAgent)
+	}
+}
+
+func TestRoundTripControlCharacters(t *testing.T) {
+	var buff bytes.Buffer
+	l := negroni.NewCombinedLogger()
+	l.ALogger = log.New(&buff, "", 0)
+
+	n := negroni.New(l)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	agent := "a\tb\nc\b\r\v\x01\\\"\xff"
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", agent)
+	n.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := strings.TrimSuffix(buff.String(), "\n")
+	if !strings.HasSuffix(line, `"a\tb\nc\b\r\v\x01\\\"\xff"`) {
+		t.Errorf("unexpected escaping: %s", line)
+	}
+	rec, err := Parse(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.UserAgent != agent {
+		t.Errorf("expected %q, got %q", agent, rec.UserAgent)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buff bytes.Buffer
+	l := negroni.NewCombinedLogger()
+	l.ALogger = log.New(&buff, "", 0)
+
+	n := negroni.New(l)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("hello"))
+	}))
+	for _, path := range []string{"/one", "/two?x=1"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("User-Agent", `quote " agent`)
+		n.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	buff.WriteString("\n")
+
+	reader := NewReader(strings.NewReader(buff.String()))
+	var records []*Record
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+
+	entry := records[1].LoggerEntry()
+	if entry.Path != "/two" || entry.Status != 200 || entry.Size != 5 || entry.RemoteAddr != "192.0.2.1" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if entry.UserAgent != `quote " agent` || entry.Request.URL.Query().Get("x") != "1" {
+		t.Errorf("unexpected request fields: %+v", entry)
+	}
+}
@@ -0,0 +1,118 @@
+package negroni
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// CLFDateFormat 是NCSA日志格式中使用的时间格式
+const CLFDateFormat = "02/Jan/2006:15:04:05 -0700"
+
+// CommonLogFormatter 输出NCSA Common Log Format格式的日志，例如
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326
+//
+// 输出和Apache完全一致，需要配合没有前缀的ALogger使用，例如log.New(w, "", 0)。
+// 这种格式只能表示结束的请求，开始和慢请求警告的日志不会输出
+type CommonLogFormatter struct{}
+
+// FormatLog 实现LogFormatter接口方法
+func (f *CommonLogFormatter) FormatLog(entry *LoggerEntry) (string, error) {
+	if entry.Phase != "" {
+		return "", nil
+	}
+	buff := &bytes.Buffer{}
+	writeCommonLog(buff, entry)
+	return buff.String(), nil
+}
+
+// CombinedLogFormatter 输出NCSA Combined Log Format格式的日志，
+// 在Common Log Format之后追加了referer和user agent
+type CombinedLogFormatter struct{}
+
+// FormatLog 实现LogFormatter接口方法
+func (f *CombinedLogFormatter) FormatLog(entry *LoggerEntry) (string, error) {
+	if entry.Phase != "" {
+		return "", nil
+	}
+	buff := &bytes.Buffer{}
+	writeCommonLog(buff, entry)
+	buff.WriteString(` "`)
+	writeCLFEscaped(buff, dashIfEmpty(entry.Referer))
+	buff.WriteString(`" "`)
+	writeCLFEscaped(buff, dashIfEmpty(entry.UserAgent))
+	buff.WriteByte('"')
+	return buff.String(), nil
+}
+
+func writeCommonLog(buff *bytes.Buffer, entry *LoggerEntry) {
+	requestURI := ""
+	if entry.Request != nil {
+		requestURI = entry.Request.RequestURI
+		if requestURI == "" && entry.Request.URL != nil {
+			requestURI = entry.Request.URL.RequestURI()
+		}
+	}
+	size := "-"
+	if entry.Size > 0 {
+		size = strconv.Itoa(entry.Size)
+	}
+
+	writeCLFEscaped(buff, dashIfEmpty(entry.RemoteAddr))
+	buff.WriteString(" - ")
+	writeCLFEscaped(buff, dashIfEmpty(entry.User))
+	buff.WriteString(" [")
+	buff.WriteString(entry.Start.Format(CLFDateFormat))
+	buff.WriteString(`] "`)
+	writeCLFEscaped(buff, entry.Method+" "+requestURI+" "+entry.Proto)
+	fmt.Fprintf(buff, `" %d %s`, entry.Status, size)
+}
+
+// clfControlEscapes 是Apache用字母转义的控制字符
+var clfControlEscapes = map[byte]byte{'\b': 'b', '\n': 'n', '\r': 'r', '\t': 't', '\v': 'v'}
+
+// writeCLFEscaped 按Apache(ap_escape_logitem)的规则转义：引号和反斜杠前加反斜杠，
+// \b \n \r \t \v 写成对应的字母转义，其他不可打印的字节写成\xhh
+func writeCLFEscaped(buff *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			buff.WriteByte('\\')
+			buff.WriteByte(c)
+		case clfControlEscapes[c] != 0:
+			buff.WriteByte('\\')
+			buff.WriteByte(clfControlEscapes[c])
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(buff, `\x%02x`, c)
+		default:
+			buff.WriteByte(c)
+		}
+	}
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// NewCommonLogger 返回一个输出Common Log Format的Logger，日志行没有前缀
+func NewCommonLogger() *Logger {
+	logger := NewLogger()
+	logger.ALogger = log.New(os.Stdout, "", 0)
+	logger.Formatter = &CommonLogFormatter{}
+	return logger
+}
+
+// NewCombinedLogger 返回一个输出Combined Log Format的Logger，日志行没有前缀
+func NewCombinedLogger() *Logger {
+	logger := NewLogger()
+	logger.ALogger = log.New(os.Stdout, "", 0)
+	logger.Formatter = &CombinedLogFormatter{}
+	return logger
+}
@@ -0,0 +1,81 @@
+package negroni
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCLFEntry() *LoggerEntry {
+	req, _ := http.NewRequest("GET", "http://localhost/apache_pb.gif?a=1", nil)
+	req.RequestURI = "/apache_pb.gif?a=1"
+	return &LoggerEntry{
+		Start:      time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600)),
+		Status:     http.StatusOK,
+		Method:     "GET",
+		Size:       2326,
+		RemoteAddr: "127.0.0.1",
+		User:       "frank",
+		Referer:    "http://www.example.com/start.html",
+		UserAgent:  "Mozilla/4.08 [en] (Win98; I ;Nav)",
+		Proto:      "HTTP/1.0",
+		Request:    req,
+	}
+}
+
+func TestCommonLogFormatter(t *testing.T) {
+	line, _ := (&CommonLogFormatter{}).FormatLog(newCLFEntry())
+	expect(t, line, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif?a=1 HTTP/1.0" 200 2326`)
+
+	entry := newCLFEntry()
+	entry.User = ""
+	entry.Size = 0
+	entry.RemoteAddr = ""
+	line, _ = (&CommonLogFormatter{}).FormatLog(entry)
+	expect(t, line, `- - - [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif?a=1 HTTP/1.0" 200 -`)
+}
+
+func TestCombinedLogFormatter(t *testing.T) {
+	line, _ := (&CombinedLogFormatter{}).FormatLog(newCLFEntry())
+	expect(t, line, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif?a=1 HTTP/1.0" 200 2326 `+
+		`"http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`)
+
+	entry := newCLFEntry()
+	entry.Referer = ""
+	entry.UserAgent = "evil\" \\agent\n"
+	line, _ = (&CombinedLogFormatter{}).FormatLog(entry)
+	expect(t, strings.HasSuffix(line, `"-" "evil\" \\agent\n"`), true)
+
+	// 与Apache一样，常见的控制字符使用字母转义
+	entry.UserAgent = "a\tb\nc\x01\x7f"
+	line, _ = (&CombinedLogFormatter{}).FormatLog(entry)
+	expect(t, strings.HasSuffix(line, `"a\tb\nc\x01\x7f"`), true)
+}
+
+func TestLoggerCombinedEntry(t *testing.T) {
+	var buff bytes.Buffer
+	l := NewCombinedLogger()
+	l.ALogger = log.New(&buff, "", 0)
+
+	n := New()
+	n.Use(l)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+		rw.Write([]byte("short and stout"))
+	}))
+
+	req := httptest.NewRequest("GET", "/tea?token=abc", nil)
+	req.RemoteAddr = "10.0.0.1:52100"
+	req.SetBasicAuth("alice", "pw")
+	req.Header.Set("Referer", "http://example.com/")
+	req.Header.Set("User-Agent", "curl/7.64")
+	n.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := strings.TrimSuffix(buff.String(), "\n")
+	expect(t, strings.HasPrefix(line, "10.0.0.1 - alice ["), true)
+	expect(t, strings.HasSuffix(line, `] "GET /tea?token=[REDACTED] HTTP/1.1" 418 15 "http://example.com/" "curl/7.64"`), true)
+}
@@ -0,0 +1,77 @@
+// bundle 把一个目录中的静态文件打包成Go源码，生成的变量是*negroni.MemoryFS，
+// 可以直接作为negroni.Static的Dir使用
+//
+//	bundle -dir ./public -pkg assets -var Public -o assets/public.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+func main() {
+	dir := flag.String("dir", "public", "要打包的目录")
+	pkg := flag.String("pkg", "assets", "生成代码的包名")
+	name := flag.String("var", "Assets", "生成的变量名")
+	out := flag.String("o", "", "输出文件，为空时输出到标准输出")
+	flag.Parse()
+
+	var src bytes.Buffer
+	if err := writeBundleSource(&src, *dir, *pkg, *name); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *out == "" {
+		os.Stdout.Write(src.Bytes())
+		return
+	}
+	if err := ioutil.WriteFile(*out, src.Bytes(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// writeBundleSource 把dir目录中的所有文件写成一个Go源文件，
+// 其中名为varName的变量是包含这些文件的*negroni.MemoryFS
+func writeBundleSource(w io.Writer, dir, pkg, varName string) error {
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by bundle; DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	fmt.Fprintf(&src, "import (\n\t\"GolangStudyNotes/negroni\"\n\t\"time\"\n)\n\n")
+	fmt.Fprintf(&src, "// %s 是%s目录打包后的静态文件\n", varName, filepath.Base(dir))
+	fmt.Fprintf(&src, "var %s = negroni.NewMemoryFS(map[string]negroni.MemoryFile{\n", varName)
+
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&src, "%s: {Data: []byte(%s), ModTime: time.Unix(%d, 0)},\n",
+			strconv.Quote("/"+filepath.ToSlash(rel)), strconv.Quote(string(data)), info.ModTime().Unix())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	src.WriteString("})\n")
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(formatted)
+	return err
+}
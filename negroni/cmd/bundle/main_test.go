@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteBundleSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "negroni-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{"index.html": "<h1>\"home\"</h1>", "img/dot.bin": "\x00\xff\x01"}
+	for name, content := range files {
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var src bytes.Buffer
+	if err := writeBundleSource(&src, dir, "assets", "Public"); err != nil {
+		t.Fatal(err)
+	}
+	out := src.String()
+	for _, want := range []string{
+		"// Code generated by bundle; DO NOT EDIT.",
+		"var Public = negroni.NewMemoryFS(",
+		`"/img/dot.bin": {Data: []byte("\x00\xff\x01")`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("generated source does not contain %q:\n%s", want, out)
+		}
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, "public.go"), out, 0); err != nil {
+		t.Fatalf("generated source does not parse: %s\n%s", err, out)
+	}
+
+	if err := writeBundleSource(&src, filepath.Join(dir, "missing"), "assets", "Public"); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
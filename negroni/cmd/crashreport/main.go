@@ -0,0 +1,82 @@
+// crashreport 用来查看negroni.FileCrashReporter保存的crash报告
+//
+//	crashreport -dir ./crashes list
+//	crashreport -dir ./crashes show <fingerprint>
+package main
+
+import (
+	"GolangStudyNotes/negroni"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func main() {
+	dir := flag.String("dir", "crashes", "crash报告所在的目录")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-dir dir] list | show <fingerprint>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var err error
+	switch flag.Arg(0) {
+	case "list":
+		err = list(*dir)
+	case "show":
+		if flag.NArg() < 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		err = show(*dir, flag.Arg(1))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// list 输出所有报告的摘要，最近发生的在前
+func list(dir string) error {
+	reports, err := negroni.ReadCrashReports(dir)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FINGERPRINT\tCOUNT\tLAST SEEN\tPANIC")
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", report.Fingerprint, report.Count, report.LastSeen.Format(time.RFC3339), report.Panic)
+	}
+	return w.Flush()
+}
+
+// show 输出一个报告的全部内容
+func show(dir, fingerprint string) error {
+	report, err := negroni.ReadCrashReport(dir, fingerprint)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Fingerprint: %s\n", report.Fingerprint)
+	fmt.Printf("Panic:       %s\n", report.Panic)
+	fmt.Printf("Count:       %d\n", report.Count)
+	fmt.Printf("First seen:  %s\n", report.FirstSeen.Format(time.RFC3339))
+	fmt.Printf("Last seen:   %s\n", report.LastSeen.Format(time.RFC3339))
+	fmt.Printf("Goroutines:  %d\n", report.Goroutines)
+	if report.RequestID != "" {
+		fmt.Printf("Request ID:  %s\n", report.RequestID)
+	}
+	fmt.Printf("Go version:  %s\n", report.Build.GoVersion)
+	if report.Build.Path != "" {
+		fmt.Printf("Module:      %s %s\n", report.Build.Path, report.Build.Version)
+	}
+	if rev, ok := report.Build.Settings["vcs.revision"]; ok {
+		fmt.Printf("Revision:    %s\n", rev)
+	}
+	fmt.Printf("\n%s\n%s\n", report.Request, report.Stack)
+	return nil
+}
@@ -0,0 +1,26 @@
+// fingerprint 把静态文件复制到输出目录，为每个文件生成带内容hash的副本，
+// 并写出manifest.json，供negroni.AssetManifest使用
+//
+//	fingerprint -src ./public -dst ./dist
+package main
+
+import (
+	"GolangStudyNotes/negroni"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	src := flag.String("src", "public", "静态文件所在的目录")
+	dst := flag.String("dst", "dist", "输出目录")
+	flag.Parse()
+
+	m, err := negroni.BuildAssetManifest(*src, *dst)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("fingerprinted %d files, manifest written to %s\n", len(m), filepath.Join(*dst, negroni.DefaultAssetManifestName))
+}
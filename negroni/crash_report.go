@@ -0,0 +1,311 @@
+package negroni
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const crashReportExt = ".json"
+
+// CrashReporter 接收Recovery恢复的panic并把它持久化
+type CrashReporter interface {
+	// ReportCrash 保存一次panic，stack是完整的原始堆栈
+	ReportCrash(infos *PanicInformation, stack []byte) error
+}
+
+// CrashBuildInfo 是产生crash的程序的构建信息
+type CrashBuildInfo struct {
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path,omitempty"`
+	Version   string            `json:"version,omitempty"`
+	Settings  map[string]string `json:"settings,omitempty"`
+}
+
+// CrashReport 是一次panic的持久化记录，相同指纹的panic只保存一份并累加次数
+type CrashReport struct {
+	Fingerprint string         `json:"fingerprint"`
+	Panic       string         `json:"panic"`
+	FirstSeen   time.Time      `json:"first_seen"`
+	LastSeen    time.Time      `json:"last_seen"`
+	Count       int            `json:"count"`
+	Goroutines  int            `json:"goroutines"`
+	RequestID   string         `json:"request_id,omitempty"`
+	Request     string         `json:"request"`
+	Stack       string         `json:"stack"`
+	Build       CrashBuildInfo `json:"build"`
+}
+
+// FileCrashReporter 把每个panic保存为Dir目录下的一个json文件，文件名是堆栈指纹
+type FileCrashReporter struct {
+	// Dir 是保存crash报告的目录，不存在时会自动创建
+	Dir string
+	// MaxReports 是最多保留的报告数量，为0时不限制
+	MaxReports int
+	// MaxBytes 是所有报告最多占用的字节数，为0时不限制
+	MaxBytes int64
+
+	mutex sync.Mutex
+	// index 是Dir中已有报告的大小和最后发生时间，第一次保存报告时从磁盘加载，
+	// 之后只在内存中更新，轮转时不需要重新扫描目录
+	index    map[string]crashIndexEntry
+	indexDir string
+}
+
+// crashIndexEntry 是索引中的一份报告
+type crashIndexEntry struct {
+	size     int64
+	lastSeen time.Time
+}
+
+// NewFileCrashReporter 返回一个新的FileCrashReporter实例
+func NewFileCrashReporter(dir string) *FileCrashReporter {
+	return &FileCrashReporter{
+		Dir:        dir,
+		MaxReports: 100,
+		MaxBytes:   10 * 1024 * 1024,
+	}
+}
+
+// ReportCrash 实现CrashReporter接口方法
+func (f *FileCrashReporter) ReportCrash(infos *PanicInformation, stack []byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := os.MkdirAll(f.Dir, 0755); err != nil {
+		return err
+	}
+	if err := f.loadIndex(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	fingerprint := StackFingerprint(stack)
+	var report *CrashReport
+	if _, ok := f.index[fingerprint]; ok {
+		var err error
+		report, err = ReadCrashReport(f.Dir, fingerprint)
+		if err != nil && isPathError(err) && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if report == nil {
+		// 没有报告或已有的报告无法解析时，用新的报告覆盖
+		report = &CrashReport{Fingerprint: fingerprint, FirstSeen: now}
+	}
+	report.Panic = infos.PanicDescription()
+	report.LastSeen = now
+	report.Count++
+	report.Goroutines = runtime.NumGoroutine()
+	report.RequestID = infos.RequestID
+	report.Request = dumpRequest(infos.Request, infos.Redaction)
+	report.Stack = string(stack)
+	report.Build = readCrashBuildInfo()
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(crashReportPath(f.Dir, fingerprint), data); err != nil {
+		return err
+	}
+	f.index[fingerprint] = crashIndexEntry{size: int64(len(data)), lastSeen: now}
+	return f.rotate()
+}
+
+// loadIndex 在索引为空或Dir变化时扫描目录建立索引，无法解析的报告会被删除
+func (f *FileCrashReporter) loadIndex() error {
+	if f.index != nil && f.indexDir == f.Dir {
+		return nil
+	}
+	files, err := crashReportFiles(f.Dir)
+	if err != nil {
+		return err
+	}
+	index := make(map[string]crashIndexEntry, len(files))
+	for _, fi := range files {
+		fingerprint := strings.TrimSuffix(fi.Name(), crashReportExt)
+		report, err := ReadCrashReport(f.Dir, fingerprint)
+		if err != nil {
+			if !isPathError(err) {
+				if err := os.Remove(filepath.Join(f.Dir, fi.Name())); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+			continue
+		}
+		index[fingerprint] = crashIndexEntry{size: fi.Size(), lastSeen: report.LastSeen}
+	}
+	f.index = index
+	f.indexDir = f.Dir
+	return nil
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再重命名，读取者不会看到写了一半的文件
+func writeFileAtomic(file string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".crash-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// isPathError 返回err是否是读取文件时的IO错误，而不是内容无法解析
+func isPathError(err error) bool {
+	_, ok := err.(*os.PathError)
+	return ok
+}
+
+// rotate 按索引从最旧的报告开始删除，直到数量和大小都不超过限制，最新的报告总是保留
+func (f *FileCrashReporter) rotate() error {
+	fingerprints := make([]string, 0, len(f.index))
+	var total int64
+	for fingerprint, entry := range f.index {
+		fingerprints = append(fingerprints, fingerprint)
+		total += entry.size
+	}
+	// 按最后发生时间从新到旧排列
+	sort.Slice(fingerprints, func(i, j int) bool {
+		return f.index[fingerprints[i]].lastSeen.After(f.index[fingerprints[j]].lastSeen)
+	})
+	for n := len(fingerprints); n > 1; n-- {
+		overCount := f.MaxReports > 0 && n > f.MaxReports
+		overSize := f.MaxBytes > 0 && total > f.MaxBytes
+		if !overCount && !overSize {
+			break
+		}
+		oldest := fingerprints[n-1]
+		if err := os.Remove(crashReportPath(f.Dir, oldest)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= f.index[oldest].size
+		delete(f.index, oldest)
+	}
+	return nil
+}
+
+// StackFingerprint 根据发生panic的goroutine的调用帧计算指纹
+// 同一代码路径上的panic有相同的指纹，和参数、goroutine编号无关
+func StackFingerprint(stack []byte) string {
+	h := sha1.New()
+	goroutines := ParseStack(stack)
+	if len(goroutines) == 0 {
+		h.Write(stack)
+	} else {
+		for _, frame := range goroutines[0].Frames {
+			fmt.Fprintf(h, "%s %s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// ReadCrashReport 读取dir目录下指定指纹的报告
+func ReadCrashReport(dir, fingerprint string) (*CrashReport, error) {
+	data, err := ioutil.ReadFile(crashReportPath(dir, fingerprint))
+	if err != nil {
+		return nil, err
+	}
+	report := &CrashReport{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ReadCrashReports 读取dir目录下的所有报告，按最后发生时间从新到旧排列
+// 无法读取或解析的报告会被跳过，不影响其他报告
+func ReadCrashReports(dir string) ([]*CrashReport, error) {
+	files, err := crashReportFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]*CrashReport, 0, len(files))
+	for _, fi := range files {
+		report, err := ReadCrashReport(dir, strings.TrimSuffix(fi.Name(), crashReportExt))
+		if err != nil {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].LastSeen.After(reports[j].LastSeen)
+	})
+	return reports, nil
+}
+
+// crashReportFiles 返回dir目录下的所有报告文件
+func crashReportFiles(dir string) ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := infos[:0]
+	for _, fi := range infos {
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), crashReportExt) {
+			files = append(files, fi)
+		}
+	}
+	return files, nil
+}
+
+func crashReportPath(dir, fingerprint string) string {
+	return filepath.Join(dir, filepath.Base(fingerprint)+crashReportExt)
+}
+
+// dumpRequest 返回按policy脱敏后的request文本，不包含body
+func dumpRequest(r *http.Request, policy *RedactionPolicy) string {
+	if r == nil {
+		return nilRequestMessage
+	}
+	dump, err := httputil.DumpRequest(policy.RedactRequest(r), false)
+	if err != nil {
+		return fmt.Sprintf("%s %s", r.Method, policy.RedactURL(r.URL))
+	}
+	return string(dump)
+}
+
+func readCrashBuildInfo() CrashBuildInfo {
+	build := CrashBuildInfo{GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+	build.Path = info.Main.Path
+	build.Version = info.Main.Version
+	if len(info.Settings) > 0 {
+		build.Settings = make(map[string]string, len(info.Settings))
+		for _, s := range info.Settings {
+			build.Settings[s.Key] = s.Value
+		}
+	}
+	return build
+}
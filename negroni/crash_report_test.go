@@ -0,0 +1,176 @@
+package negroni
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newCrashDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "negroni-crash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRecoveryCrashReporter(t *testing.T) {
+	dir := newCrashDir(t)
+	defer os.RemoveAll(dir)
+
+	rec := NewRecovery()
+	rec.Logger = log.New(&bytes.Buffer{}, "", 0)
+	rec.CrashReporter = NewFileCrashReporter(dir)
+
+	n := New()
+	n.Use(rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic("crash report")
+	}))
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "http://localhost:3000/crash", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("X-Trace", "visible")
+		n.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	reports, err := ReadCrashReports(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, len(reports), 1)
+	report := reports[0]
+	expect(t, report.Panic, "crash report")
+	expect(t, report.Count, 3)
+	refute(t, report.Goroutines, 0)
+	refute(t, report.Build.GoVersion, "")
+	expect(t, strings.Contains(report.Stack, "TestRecoveryCrashReporter"), true)
+	expect(t, strings.Contains(report.Request, "GET /crash"), true)
+	expect(t, strings.Contains(report.Request, "X-Trace: visible"), true)
+	expect(t, strings.Contains(report.Request, "secret"), false)
+
+	same, err := ReadCrashReport(dir, report.Fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, same.Count, 3)
+}
+
+func TestFileCrashReporterRotateByCount(t *testing.T) {
+	dir := newCrashDir(t)
+	defer os.RemoveAll(dir)
+
+	reporter := NewFileCrashReporter(dir)
+	reporter.MaxReports = 2
+	for _, stack := range []string{"one", "two", "three"} {
+		infos := &PanicInformation{RecoveredPanic: stack}
+		if err := reporter.ReportCrash(infos, []byte(stack)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reports, err := ReadCrashReports(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, len(reports), 2)
+	expect(t, reports[0].Panic, "three")
+	expect(t, reports[1].Panic, "two")
+}
+
+func TestFileCrashReporterRotateBySize(t *testing.T) {
+	dir := newCrashDir(t)
+	defer os.RemoveAll(dir)
+
+	reporter := NewFileCrashReporter(dir)
+	reporter.MaxBytes = 1
+	for _, stack := range []string{"one", "two"} {
+		infos := &PanicInformation{RecoveredPanic: stack}
+		if err := reporter.ReportCrash(infos, []byte(stack)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reports, err := ReadCrashReports(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, len(reports), 1)
+	expect(t, reports[0].Panic, "two")
+}
+
+func TestFileCrashReporterIndex(t *testing.T) {
+	dir := newCrashDir(t)
+	defer os.RemoveAll(dir)
+
+	first := NewFileCrashReporter(dir)
+	for _, stack := range []string{"one", "two"} {
+		if err := first.ReportCrash(&PanicInformation{RecoveredPanic: stack}, []byte(stack)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 新的reporter从磁盘加载已有的报告，之后只使用内存中的索引
+	reporter := NewFileCrashReporter(dir)
+	reporter.MaxReports = 2
+	expect(t, reporter.ReportCrash(&PanicInformation{RecoveredPanic: "three"}, []byte("three")), nil)
+	expect(t, len(reporter.index), 2)
+
+	// 索引加载之后出现的文件不会被重新扫描
+	ioutil.WriteFile(filepath.Join(dir, "later.json"), []byte("garbage"), 0644)
+	expect(t, reporter.ReportCrash(&PanicInformation{RecoveredPanic: "three"}, []byte("three")), nil)
+	_, err := os.Stat(filepath.Join(dir, "later.json"))
+	expect(t, err, nil)
+
+	reports, err := ReadCrashReports(dir)
+	expect(t, err, nil)
+	expect(t, len(reports), 2)
+	expect(t, reports[0].Panic, "three")
+	expect(t, reports[0].Count, 2)
+	expect(t, reports[1].Panic, "two")
+}
+
+func TestStackFingerprint(t *testing.T) {
+	other := strings.Replace(sampleStack, "goroutine 7", "goroutine 42", 1)
+	other = strings.Replace(other, "0xc0000a4000", "0xc000123456", 1)
+	expect(t, StackFingerprint([]byte(sampleStack)), StackFingerprint([]byte(other)))
+
+	moved := strings.Replace(sampleStack, "main.go:12", "main.go:13", 1)
+	refute(t, StackFingerprint([]byte(sampleStack)), StackFingerprint([]byte(moved)))
+}
+
+func TestFileCrashReporterCorruptReports(t *testing.T) {
+	dir := newCrashDir(t)
+	defer os.RemoveAll(dir)
+
+	// 一个被截断的报告和一个与新panic指纹相同的损坏报告
+	ioutil.WriteFile(filepath.Join(dir, "truncated.json"), []byte(`{"fingerprint": "trun`), 0644)
+	ioutil.WriteFile(crashReportPath(dir, StackFingerprint([]byte("one"))), []byte("garbage"), 0644)
+
+	reports, err := ReadCrashReports(dir)
+	expect(t, err, nil)
+	expect(t, len(reports), 0)
+
+	reporter := NewFileCrashReporter(dir)
+	reporter.MaxReports = 1
+	for _, stack := range []string{"one", "two", "three", "four"} {
+		infos := &PanicInformation{RecoveredPanic: stack}
+		if err := reporter.ReportCrash(infos, []byte(stack)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	expect(t, len(files), 1)
+	reports, err = ReadCrashReports(dir)
+	expect(t, err, nil)
+	expect(t, len(reports), 1)
+	expect(t, reports[0].Panic, "four")
+}
@@ -0,0 +1,250 @@
+package negroni
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultDevBodyBytes 是DevLogFormatter默认显示的body字节数
+const DefaultDevBodyBytes = 256
+
+// BodyCapturer 是需要请求和响应body片段的LogFormatter，
+// Logger会为它截取每个请求和响应body的前BodyCaptureLimit个字节
+type BodyCapturer interface {
+	BodyCaptureLimit() int
+}
+
+// DevLogFormatter 输出适合在本地开发时阅读的对齐的日志，例如
+//
+//	15:04:05 | 200 |    12.3ms | GET     /orders/42
+//
+// 对于失败的请求(状态码不小于400)还可以输出请求header和body片段
+type DevLogFormatter struct {
+	// Color 为true时使用ANSI颜色
+	Color bool
+	// ShowHeaders 为true时失败的请求会输出请求header
+	ShowHeaders bool
+	// BodyBytes 是失败的请求输出的请求和响应body的字节数，为0时不输出
+	BodyBytes int
+}
+
+// BodyCaptureLimit 实现BodyCapturer接口方法
+func (f *DevLogFormatter) BodyCaptureLimit() int {
+	return f.BodyBytes
+}
+
+// FormatLog 实现LogFormatter接口方法
+func (f *DevLogFormatter) FormatLog(entry *LoggerEntry) (string, error) {
+	buff := &bytes.Buffer{}
+	buff.WriteString(entry.Start.Format("15:04:05"))
+	buff.WriteString(" | ")
+
+	switch entry.Phase {
+	case LogPhaseStart:
+		buff.WriteString(f.paint(colorBlue, "-->"))
+		fmt.Fprintf(buff, " |           | %s %s", f.method(entry.Method), entry.Path)
+		return buff.String(), nil
+	case LogPhaseRunning:
+		buff.WriteString(f.paint(colorYellow, "..."))
+		fmt.Fprintf(buff, " | %9s | %s %s %s", HumanizeDuration(entry.Duration), f.method(entry.Method), entry.Path,
+			f.paint(colorYellow, "still running"))
+		return buff.String(), nil
+	case LogPhaseReport:
+		buff.WriteString(f.paint(colorCyan, "---"))
+		fmt.Fprintf(buff, " | %9s | suppressed", HumanizeDuration(entry.Duration))
+		for _, field := range entry.Fields {
+			fmt.Fprintf(buff, " %s=%v", field.Name, field.Value)
+		}
+		return buff.String(), nil
+	}
+
+	status := padLeft(3, entry.Status)
+	if f.Color {
+		status = colorByStatus(entry.Status, status)
+	}
+	duration := padLeft(9, HumanizeDuration(entry.Duration))
+	if entry.Slow {
+		duration = f.paint(colorYellow, duration)
+	}
+	fmt.Fprintf(buff, "%s | %s | %s %s", status, duration, f.method(entry.Method), entry.Path)
+	if entry.Size > 0 {
+		fmt.Fprintf(buff, " (%s)", humanizeBytes(entry.Size))
+	}
+	if entry.Slow {
+		buff.WriteString(" " + f.paint(colorYellow, "slow"))
+	}
+
+	if entry.Status >= 400 {
+		if f.ShowHeaders && entry.Request != nil {
+			names := make([]string, 0, len(entry.Request.Header))
+			for name := range entry.Request.Header {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(buff, "\n    > %s: %s", name, strings.Join(entry.Request.Header[name], ", "))
+			}
+		}
+		if len(entry.RequestBody) > 0 {
+			fmt.Fprintf(buff, "\n    > body: %q", entry.RequestBody)
+		}
+		if len(entry.ResponseBody) > 0 {
+			fmt.Fprintf(buff, "\n    < body: %q", entry.ResponseBody)
+		}
+	}
+	return buff.String(), nil
+}
+
+// method 返回补齐到7个字符的请求方法
+func (f *DevLogFormatter) method(method string) string {
+	return f.paint(colorBold, padRight(7, method))
+}
+
+func (f *DevLogFormatter) paint(color, s string) string {
+	if !f.Color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// HumanizeDuration 返回便于阅读的耗时，例如 850µs、12.3ms、1.25s
+func HumanizeDuration(d time.Duration) string {
+	switch {
+	case d < time.Microsecond:
+		return fmt.Sprintf("%dns", d.Nanoseconds())
+	case d < time.Millisecond:
+		return fmt.Sprintf("%dµs", d/time.Microsecond)
+	case d < time.Second:
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	case d < time.Minute:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	default:
+		return d.Round(time.Second).String()
+	}
+}
+
+func humanizeBytes(n int) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	}
+}
+
+// IsTerminal 返回f是否是一个终端
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// NewDevLogger 返回一个适合本地开发的Logger。
+// 标准输出是终端时使用带颜色的DevLogFormatter(设置了NO_COLOR环境变量时不使用颜色)，
+// 否则保持NewLogger的普通格式
+func NewDevLogger() *Logger {
+	logger := NewLogger()
+	if IsTerminal(os.Stdout) {
+		logger.ALogger = log.New(os.Stdout, "", 0)
+		logger.Formatter = &DevLogFormatter{
+			Color:       os.Getenv("NO_COLOR") == "",
+			ShowHeaders: true,
+			BodyBytes:   DefaultDevBodyBytes,
+		}
+	}
+	return logger
+}
+
+// captureBuffer 只保留写入内容的前limit个字节
+type captureBuffer struct {
+	limit int
+	buff  bytes.Buffer
+}
+
+func (c *captureBuffer) capture(p []byte) {
+	if n := c.limit - c.buff.Len(); n > 0 {
+		if len(p) > n {
+			p = p[:n]
+		}
+		c.buff.Write(p)
+	}
+}
+
+// captureReadCloser 在读取请求body的同时截取开头的部分
+type captureReadCloser struct {
+	io.ReadCloser
+	captureBuffer
+}
+
+func (c *captureReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.capture(p[:n])
+	return n, err
+}
+
+// captureResponseWriter 在写入response的同时截取body开头的部分
+type captureResponseWriter struct {
+	ResponseWriter
+	captureBuffer
+}
+
+func (c *captureResponseWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.capture(p[:n])
+	return n, err
+}
+
+// Hijack 接管连接，之后写入的内容不会被截取
+func (c *captureResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := c.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the ResponseWriter doesn't support the Hijacker interface")
+	}
+	return hijacker.Hijack()
+}
+
+// captureResponseWriterCloseNotifier 在被包装的ResponseWriter支持CloseNotify时使用
+type captureResponseWriterCloseNotifier struct {
+	*captureResponseWriter
+}
+
+func (c *captureResponseWriterCloseNotifier) CloseNotify() <-chan bool {
+	return c.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+// captureBodies 为需要body片段的LogFormatter包装请求和响应，
+// 不需要时原样返回，两个捕获器都为nil
+func (l *Logger) captureBodies(rw http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, *captureReadCloser, *captureResponseWriter) {
+	capturer, ok := l.Formatter.(BodyCapturer)
+	if !ok || capturer.BodyCaptureLimit() <= 0 {
+		return rw, r, nil, nil
+	}
+	limit := capturer.BodyCaptureLimit()
+
+	var reqBody *captureReadCloser
+	if r.Body != nil && r.Body != http.NoBody {
+		reqBody = &captureReadCloser{ReadCloser: r.Body, captureBuffer: captureBuffer{limit: limit}}
+		r = r.WithContext(r.Context())
+		r.Body = reqBody
+	}
+	var resBody *captureResponseWriter
+	if nrw, ok := rw.(ResponseWriter); ok {
+		resBody = &captureResponseWriter{ResponseWriter: nrw, captureBuffer: captureBuffer{limit: limit}}
+		rw = resBody
+		if _, ok := nrw.(http.CloseNotifier); ok {
+			rw = &captureResponseWriterCloseNotifier{resBody}
+		}
+	}
+	return rw, r, reqBody, resBody
+}
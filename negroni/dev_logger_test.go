@@ -0,0 +1,119 @@
+package negroni
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHumanizeDuration(t *testing.T) {
+	expect(t, HumanizeDuration(500*time.Nanosecond), "500ns")
+	expect(t, HumanizeDuration(850*time.Microsecond), "850µs")
+	expect(t, HumanizeDuration(12345*time.Microsecond), "12.3ms")
+	expect(t, HumanizeDuration(1250*time.Millisecond), "1.25s")
+	expect(t, HumanizeDuration(63*time.Second+400*time.Millisecond), "1m3s")
+}
+
+func TestDevLogFormatter(t *testing.T) {
+	entry := SampleLoggerEntry()
+	line, _ := (&DevLogFormatter{}).FormatLog(entry)
+	expect(t, line, "15:04:05 | 200 |    12.3ms | GET     /orders/42 (512 B)")
+
+	line, _ = (&DevLogFormatter{Color: true}).FormatLog(entry)
+	expect(t, line, "15:04:05 | \033[32m200\033[0m |    12.3ms | \033[1mGET    \033[0m /orders/42 (512 B)")
+
+	entry.Phase = LogPhaseStart
+	line, _ = (&DevLogFormatter{}).FormatLog(entry)
+	expect(t, line, "15:04:05 | --> |           | GET     /orders/42")
+
+	report := &LoggerEntry{Start: entry.Start, Duration: time.Minute, Phase: LogPhaseReport,
+		Fields: []LogFieldValue{{LogFieldSuppressed, 3}, {LogFieldExcluded, 2}, {LogFieldSampled, 1}}}
+	line, _ = (&DevLogFormatter{}).FormatLog(report)
+	expect(t, line, "15:04:05 | --- |      1m0s | suppressed suppressed=3 excluded=2 sampled=1")
+}
+
+func TestDevLogFormatterFailingRequest(t *testing.T) {
+	var buff bytes.Buffer
+	l := NewLogger()
+	l.ALogger = log.New(&buff, "", 0)
+	l.Formatter = &DevLogFormatter{ShowHeaders: true, BodyBytes: 12}
+
+	n := New(l)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) == "ok" {
+			rw.Write([]byte("fine"))
+			return
+		}
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(`{"error":"name is required"}`))
+	}))
+
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"password=hunter2"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	recorder := httptest.NewRecorder()
+	n.ServeHTTP(recorder, req)
+
+	expect(t, recorder.Body.String(), `{"error":"name is required"}`)
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	expect(t, len(lines), 5)
+	expect(t, strings.Contains(lines[0], "400 |"), true)
+	expect(t, lines[1], "    > Authorization: [REDACTED]")
+	expect(t, lines[2], "    > Content-Type: application/json")
+	expect(t, lines[3], `    > body: "{\"[REDACTED]"`)
+	expect(t, lines[4], `    < body: "{\"error\":\"na"`)
+
+	// 成功的请求只输出一行
+	buff.Reset()
+	n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/users", strings.NewReader("ok")))
+	expect(t, strings.Count(buff.String(), "\n"), 1)
+}
+
+func TestNewDevLoggerWithoutTerminal(t *testing.T) {
+	f, err := ioutil.TempFile("", "negroni-tty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	expect(t, IsTerminal(f), false)
+
+	// 测试时标准输出不是终端，保持普通格式
+	if !IsTerminal(os.Stdout) {
+		_, ok := NewDevLogger().Formatter.(*TemplateLogFormatter)
+		expect(t, ok, true)
+	}
+}
+
+func TestDevLoggerKeepsWriterInterfaces(t *testing.T) {
+	l := NewLogger()
+	l.ALogger = log.New(ioutil.Discard, "", 0)
+	l.Formatter = &DevLogFormatter{BodyBytes: DefaultDevBodyBytes}
+
+	var hijacked, notifies, flushes bool
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		if hijacker, ok := rw.(http.Hijacker); ok {
+			_, _, err := hijacker.Hijack()
+			hijacked = err == nil
+		}
+		_, notifies = rw.(http.CloseNotifier)
+		_, flushes = rw.(http.Flusher)
+	}
+
+	hijackable := newHijackableResponse()
+	l.ServeHTTP(NewResponseWriter(hijackable), httptest.NewRequest("GET", "/ws", nil), handler)
+	expect(t, hijackable.Hijacked, true)
+	expect(t, hijacked, true)
+	expect(t, notifies, false)
+	expect(t, flushes, true)
+
+	l.ServeHTTP(NewResponseWriter(newCloseNotifyingRecorder()), httptest.NewRequest("GET", "/", nil), handler)
+	expect(t, notifies, true)
+}
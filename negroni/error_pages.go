@@ -0,0 +1,286 @@
+package negroni
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// ErrorPage 是传给错误页面模板的数据
+type ErrorPage struct {
+	Status     int
+	StatusText string
+	Method     string
+	Path       string
+	RequestID  string
+}
+
+// errorPageTypes 是支持的页面类型，客户端对几种类型没有偏好时按这个顺序选择
+var errorPageTypes = []struct {
+	mediaType string
+	ext       string
+}{
+	{"text/html", ".html"},
+	{"application/json", ".json"},
+	{"text/plain", ".txt"},
+}
+
+// ErrorPages 是一个中间件处理程序，在下游的处理程序没有写入任何内容时输出错误页面。
+// 下游只调用了WriteHeader并且状态码不小于400时，输出这个状态码的页面；
+// 下游什么都没有写时(例如Static没有找到文件，最后到达了空的中间件)，输出404页面
+type ErrorPages struct {
+	// Dir 是页面模板所在的文件系统，为nil时只输出状态码对应的文本。
+	// 页面按 状态码、状态类、error 的顺序查找，例如 404.html、4xx.html、error.html，
+	// 扩展名根据Accept在.html、.json、.txt之间选择。
+	// .html使用html/template，其他使用text/template，模板中可以用json函数输出JSON字符串
+	Dir http.FileSystem
+	// NotFound 为true时，下游什么都没有写的请求按404处理
+	NotFound bool
+
+	mutex     sync.Mutex
+	templates map[string]*errorTemplate
+}
+
+type errorTemplate struct {
+	modTime time.Time
+	execute func(io.Writer, interface{}) error
+}
+
+// NewErrorPages 返回从dir加载页面的ErrorPages
+func NewErrorPages(dir http.FileSystem) *ErrorPages {
+	return &ErrorPages{Dir: dir, NotFound: true}
+}
+
+func (e *ErrorPages) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	nrw, ok := rw.(ResponseWriter)
+	if !ok {
+		nrw = NewResponseWriter(rw)
+	}
+	w := &errorPageWriter{ResponseWriter: nrw}
+	next(w, r)
+
+	status := w.pending
+	if status == 0 && !w.Written() && e.NotFound {
+		status = http.StatusNotFound
+	}
+	if status == 0 || w.committed {
+		return
+	}
+	e.render(nrw, r, status)
+}
+
+// render 输出status的错误页面，找不到模板或模板执行失败时输出状态码对应的文本
+func (e *ErrorPages) render(rw http.ResponseWriter, r *http.Request, status int) {
+	data := &ErrorPage{
+		Status:     status,
+		StatusText: http.StatusText(status),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		RequestID:  RequestIDFromRequest(r),
+	}
+
+	var body bytes.Buffer
+	for _, ext := range acceptedErrorPageExts(r.Header.Get("Accept")) {
+		tpl, ok := e.lookup(status, ext)
+		if !ok {
+			continue
+		}
+		if err := tpl.execute(&body, data); err != nil {
+			body.Reset()
+			break
+		}
+		rw.Header().Set("Content-Type", mime.TypeByExtension(ext))
+		break
+	}
+	if body.Len() == 0 {
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		body.WriteString(strconv.Itoa(status) + " " + data.StatusText + "\n")
+	}
+
+	rw.Header().Del("Content-Length")
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(status)
+	rw.Write(body.Bytes())
+}
+
+// lookup 按 404、4xx、error 的顺序查找扩展名为ext的模板
+func (e *ErrorPages) lookup(status int, ext string) (*errorTemplate, bool) {
+	if e.Dir == nil {
+		return nil, false
+	}
+	for _, name := range []string{strconv.Itoa(status), strconv.Itoa(status/100) + "xx", "error"} {
+		if tpl, err := e.load("/" + name + ext); err == nil {
+			return tpl, true
+		}
+	}
+	return nil, false
+}
+
+// load 读取并解析模板，文件没有修改时使用缓存
+func (e *ErrorPages) load(name string) (*errorTemplate, error) {
+	f, err := e.Dir.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	e.mutex.Lock()
+	tpl, ok := e.templates[name]
+	e.mutex.Unlock()
+	if ok && tpl.modTime.Equal(fi.ModTime()) {
+		return tpl, nil
+	}
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	tpl = &errorTemplate{modTime: fi.ModTime()}
+	if path.Ext(name) == ".html" {
+		t, err := htmltemplate.New(name).Parse(string(data))
+		if err != nil {
+			return nil, err
+		}
+		tpl.execute = t.Execute
+	} else {
+		t, err := template.New(name).Funcs(template.FuncMap{"json": errorPageJSON}).Parse(string(data))
+		if err != nil {
+			return nil, err
+		}
+		tpl.execute = t.Execute
+	}
+
+	e.mutex.Lock()
+	if e.templates == nil {
+		e.templates = make(map[string]*errorTemplate)
+	}
+	e.templates[name] = tpl
+	e.mutex.Unlock()
+	return tpl, nil
+}
+
+// errorPageJSON 把v编码成JSON，用于在.json模板中安全地输出字符串
+func errorPageJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// acceptedErrorPageExts 根据Accept返回客户端接受的页面扩展名，按偏好排列
+func acceptedErrorPageExts(accept string) []string {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+	accepted := parseQualityValues(accept)
+
+	type candidate struct {
+		ext string
+		q   float64
+	}
+	var candidates []candidate
+	for _, t := range errorPageTypes {
+		q, ok := accepted[t.mediaType]
+		if !ok {
+			q, ok = accepted[t.mediaType[:strings.Index(t.mediaType, "/")]+"/*"]
+		}
+		if !ok {
+			q, ok = accepted["*/*"]
+		}
+		if ok && q > 0 {
+			candidates = append(candidates, candidate{t.ext, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	exts := make([]string, len(candidates))
+	for i, c := range candidates {
+		exts[i] = c.ext
+	}
+	return exts
+}
+
+// errorPageWriter 推迟下游写入的错误状态码，直到下游写入body。
+// 下游只写了状态码时，ErrorPages可以改为输出错误页面
+type errorPageWriter struct {
+	ResponseWriter
+	// pending 是还没有写出的错误状态码
+	pending int
+	// committed 表示下游已经写出了response
+	committed bool
+}
+
+// WriteHeader 在response写出之前，后写入的状态码替换推迟的状态码，
+// 例如下游写了404之后panic，Recovery写入的状态码会生效
+func (w *errorPageWriter) WriteHeader(status int) {
+	if w.committed {
+		return
+	}
+	if status >= http.StatusBadRequest {
+		w.pending = status
+		return
+	}
+	w.pending = 0
+	w.committed = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorPageWriter) Write(p []byte) (int, error) {
+	w.commit()
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *errorPageWriter) Flush() {
+	w.commit()
+	w.ResponseWriter.Flush()
+}
+
+func (w *errorPageWriter) Status() int {
+	if w.pending != 0 {
+		return w.pending
+	}
+	return w.ResponseWriter.Status()
+}
+
+// Written 只有状态码被推迟时返回false，这时response还可以被Recovery等中间件改写
+func (w *errorPageWriter) Written() bool {
+	return w.ResponseWriter.Written()
+}
+
+// Hijack 接管连接后不再输出错误页面
+func (w *errorPageWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the ResponseWriter doesn't support the Hijacker interface")
+	}
+	w.committed = true
+	return hijacker.Hijack()
+}
+
+// commit 写出推迟的状态码
+func (w *errorPageWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	if w.pending != 0 {
+		w.ResponseWriter.WriteHeader(w.pending)
+		w.pending = 0
+	}
+}
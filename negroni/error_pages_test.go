@@ -0,0 +1,187 @@
+package negroni
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestErrorPages() *ErrorPages {
+	return NewErrorPages(NewMemoryFS(map[string]MemoryFile{
+		"404.html":   {Data: []byte(`<h1>{{.Status}} {{.Path}} not here</h1>`)},
+		"5xx.html":   {Data: []byte(`<h1>server error {{.Status}}</h1>`)},
+		"error.html": {Data: []byte(`<h1>error {{.Status}} {{.StatusText}}</h1>`)},
+		"error.json": {Data: []byte(`{"status":{{.Status}},"path":{{json .Path}}}`)},
+	}))
+}
+
+// serveErrorPages 使用e处理请求，handler是下游的处理程序
+func serveErrorPages(e *ErrorPages, handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	n := New(e)
+	if handler != nil {
+		n.UseHandlerFunc(handler)
+	}
+	n.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestErrorPagesEmptyResponse(t *testing.T) {
+	e := newTestErrorPages()
+	req := httptest.NewRequest("GET", "/missing?a=1", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	recorder := serveErrorPages(e, nil, req)
+	expect(t, recorder.Code, http.StatusNotFound)
+	expect(t, recorder.Body.String(), "<h1>404 /missing not here</h1>")
+	expect(t, recorder.Header().Get("Content-Type"), "text/html; charset=utf-8")
+
+	// 路径会被转义
+	req = httptest.NewRequest("GET", "/<script>", nil)
+	recorder = serveErrorPages(e, nil, req)
+	expect(t, strings.Contains(recorder.Body.String(), "<script>"), false)
+
+	e.NotFound = false
+	recorder = serveErrorPages(e, nil, httptest.NewRequest("GET", "/missing", nil))
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.Len(), 0)
+}
+
+func TestErrorPagesStatusOnly(t *testing.T) {
+	e := newTestErrorPages()
+	status := func(code int) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Type", "application/octet-stream")
+			rw.WriteHeader(code)
+		}
+	}
+
+	recorder := serveErrorPages(e, status(http.StatusForbidden), httptest.NewRequest("GET", "/admin", nil))
+	expect(t, recorder.Code, http.StatusForbidden)
+	expect(t, recorder.Body.String(), "<h1>error 403 Forbidden</h1>")
+	expect(t, recorder.Header().Get("Content-Type"), "text/html; charset=utf-8")
+
+	recorder = serveErrorPages(e, status(http.StatusBadGateway), httptest.NewRequest("GET", "/", nil))
+	expect(t, recorder.Body.String(), "<h1>server error 502</h1>")
+
+	// 小于400的状态码原样返回
+	recorder = serveErrorPages(e, status(http.StatusNoContent), httptest.NewRequest("GET", "/", nil))
+	expect(t, recorder.Code, http.StatusNoContent)
+	expect(t, recorder.Body.Len(), 0)
+}
+
+func TestErrorPagesStatusThenPanic(t *testing.T) {
+	rec := NewRecovery()
+	rec.Logger = log.New(ioutil.Discard, "", 0)
+	n := New(newTestErrorPages(), rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+		panic("after status")
+	}))
+
+	// 只写了状态码时response还没有开始，Recovery可以正常返回错误，而不是中断连接
+	recorder := httptest.NewRecorder()
+	n.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	refute(t, recorder.Body.Len(), 0)
+}
+
+func TestErrorPagesStatusThenMappedPanic(t *testing.T) {
+	rec := NewRecovery()
+	rec.Logger = log.New(ioutil.Discard, "", 0)
+	rec.PrintStack = false
+	n := New(newTestErrorPages(), rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusNotFound)
+		panic(&PanicError{Status: http.StatusConflict, Message: "conflict"})
+	}))
+
+	// Recovery写入的状态码替换下游推迟的404
+	recorder := httptest.NewRecorder()
+	n.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	expect(t, recorder.Code, http.StatusConflict)
+	expect(t, recorder.Body.String(), "conflict")
+}
+
+func TestErrorPagesKeepsWrittenBody(t *testing.T) {
+	e := newTestErrorPages()
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		http.Error(rw, "custom message", http.StatusInternalServerError)
+	}
+	recorder := serveErrorPages(e, handler, httptest.NewRequest("GET", "/", nil))
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	expect(t, recorder.Body.String(), "custom message\n")
+
+	handler = func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("ok"))
+	}
+	recorder = serveErrorPages(e, handler, httptest.NewRequest("GET", "/", nil))
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "ok")
+
+	// 下游看到的是自己写入的状态码，推迟的状态码还不算写入
+	handler = func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusNotFound)
+		res := rw.(ResponseWriter)
+		expect(t, res.Status(), http.StatusNotFound)
+		expect(t, res.Written(), false)
+	}
+	serveErrorPages(e, handler, httptest.NewRequest("GET", "/", nil))
+}
+
+func TestErrorPagesNegotiation(t *testing.T) {
+	e := newTestErrorPages()
+
+	req := httptest.NewRequest("GET", `/a"b`, nil)
+	req.Header.Set("Accept", "application/json")
+	recorder := serveErrorPages(e, nil, req)
+	expect(t, recorder.Code, http.StatusNotFound)
+	expect(t, recorder.Body.String(), `{"status":404,"path":"/a\"b"}`)
+	expect(t, recorder.Header().Get("Content-Type"), "application/json")
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/html;q=0.5, application/json")
+	recorder = serveErrorPages(e, nil, req)
+	expect(t, recorder.Header().Get("Content-Type"), "application/json")
+
+	// 没有对应的模板时输出文本
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/plain")
+	recorder = serveErrorPages(e, nil, req)
+	expect(t, recorder.Body.String(), "404 Not Found\n")
+	expect(t, recorder.Header().Get("Content-Type"), "text/plain; charset=utf-8")
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "image/png")
+	recorder = serveErrorPages(e, nil, req)
+	expect(t, recorder.Body.String(), "404 Not Found\n")
+
+	expect(t, strings.Join(acceptedErrorPageExts(""), ","), ".html,.json,.txt")
+	expect(t, strings.Join(acceptedErrorPageExts("text/*, application/json;q=0.9"), ","), ".html,.txt,.json")
+	expect(t, strings.Join(acceptedErrorPageExts("*/*;q=0.1, text/html;q=0"), ","), ".json,.txt")
+}
+
+func TestErrorPagesWithStatic(t *testing.T) {
+	dir := newStaticDir(t, map[string]string{"app.js": "js"})
+	defer os.RemoveAll(dir)
+
+	n := New(newTestErrorPages(), NewStatic(http.Dir(dir)))
+	recorder := httptest.NewRecorder()
+	n.ServeHTTP(recorder, httptest.NewRequest("GET", "/app.js", nil))
+	expect(t, recorder.Body.String(), "js")
+
+	recorder = httptest.NewRecorder()
+	n.ServeHTTP(recorder, httptest.NewRequest("GET", "/missing.js", nil))
+	expect(t, recorder.Code, http.StatusNotFound)
+	expect(t, recorder.Body.String(), "<h1>404 /missing.js not here</h1>")
+
+	// 304不会被当作错误
+	req := httptest.NewRequest("GET", "/app.js", nil)
+	req.Header.Set("If-Modified-Since", "Sat, 01 Jan 2100 00:00:00 GMT")
+	recorder = httptest.NewRecorder()
+	n.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusNotModified)
+}
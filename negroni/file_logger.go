@@ -0,0 +1,413 @@
+package negroni
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// backupTimeFormat 是轮转后的文件名中使用的时间格式
+const backupTimeFormat = "20060102T150405.000"
+
+// FileLoggerOptions 是FileLogger的配置，零值表示不启用对应的功能
+type FileLoggerOptions struct {
+	// MaxSize 是单个文件的最大字节数，超过后轮转
+	MaxSize int64
+	// RotateEvery 是按时间轮转的间隔
+	RotateEvery time.Duration
+	// MaxBackups 是最多保留的旧文件数量
+	MaxBackups int
+	// MaxAge 是旧文件最长的保留时间
+	MaxAge time.Duration
+	// Compress 为true时旧文件会被gzip压缩
+	Compress bool
+	// QueueSize 是等待写入的日志队列长度，为0时使用DefaultFileLoggerQueueSize
+	QueueSize int
+}
+
+// DefaultFileLoggerQueueSize 是FileLogger默认的队列长度
+const DefaultFileLoggerQueueSize = 1024
+
+// FileLogger 是一个异步写文件的ALogger实现，可以用在Logger和Recovery中。
+// 日志先进入有界队列，由单独的goroutine写入文件；队列满或写入文件失败时日志会被丢弃并计数，
+// 不会阻塞处理请求的goroutine。旧文件的压缩在另一个goroutine中进行。
+// 程序退出前需要调用Close把剩余的日志写入文件
+type FileLogger struct {
+	filename string
+	options  FileLoggerOptions
+
+	mutex   sync.RWMutex
+	closed  bool
+	queue   chan fileLogMessage
+	done    chan struct{}
+	dropped uint64
+
+	errMutex sync.Mutex
+	err      error
+	// compress 是等待压缩的旧文件，只在Compress开启时使用
+	compress   chan string
+	compressed chan struct{}
+
+	// 以下字段只在写入goroutine中使用
+	file     *os.File
+	writer   *bufio.Writer
+	buffered uint64
+	size     int64
+	openedAt time.Time
+	now      func() time.Time
+	rename   func(oldpath, newpath string) error
+}
+
+// fileLogMessage 是队列中的一条日志，flushed不为nil时表示一次Flush请求
+type fileLogMessage struct {
+	data    []byte
+	flushed chan error
+}
+
+// NewFileLogger 打开(或创建)filename并返回一个新的FileLogger实例
+func NewFileLogger(filename string, options FileLoggerOptions) (*FileLogger, error) {
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultFileLoggerQueueSize
+	}
+	f := &FileLogger{
+		filename: filename,
+		options:  options,
+		queue:    make(chan fileLogMessage, options.QueueSize),
+		done:     make(chan struct{}),
+		now:      time.Now,
+		rename:   os.Rename,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	if options.Compress {
+		f.compress = make(chan string, 16)
+		f.compressed = make(chan struct{})
+		go f.runCompress()
+	}
+	go f.run()
+	return f, nil
+}
+
+// Println 实现ALogger接口方法
+func (f *FileLogger) Println(v ...interface{}) {
+	f.enqueue(fmt.Sprintln(v...))
+}
+
+// Printf 实现ALogger接口方法
+func (f *FileLogger) Printf(format string, v ...interface{}) {
+	s := fmt.Sprintf(format, v...)
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	f.enqueue(s)
+}
+
+// Dropped 返回因为队列已满、已关闭或写入文件失败而丢弃的日志条数
+func (f *FileLogger) Dropped() uint64 {
+	return atomic.LoadUint64(&f.dropped)
+}
+
+func (f *FileLogger) drop(n uint64) {
+	atomic.AddUint64(&f.dropped, n)
+}
+
+func (f *FileLogger) enqueue(s string) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	if f.closed {
+		f.drop(1)
+		return
+	}
+	select {
+	case f.queue <- fileLogMessage{data: []byte(s)}:
+	default:
+		f.drop(1)
+	}
+}
+
+// Flush 等待队列中已有的日志都写入文件
+func (f *FileLogger) Flush() error {
+	f.mutex.RLock()
+	if f.closed {
+		f.mutex.RUnlock()
+		return os.ErrClosed
+	}
+	flushed := make(chan error, 1)
+	f.queue <- fileLogMessage{flushed: flushed}
+	f.mutex.RUnlock()
+	return <-flushed
+}
+
+// Close 写入队列中剩余的日志并关闭文件，之后的日志都会被丢弃
+func (f *FileLogger) Close() error {
+	f.mutex.Lock()
+	if f.closed {
+		f.mutex.Unlock()
+		return os.ErrClosed
+	}
+	f.closed = true
+	close(f.queue)
+	f.mutex.Unlock()
+
+	<-f.done
+	f.errMutex.Lock()
+	defer f.errMutex.Unlock()
+	return f.err
+}
+
+// run 是写入goroutine的主循环
+func (f *FileLogger) run() {
+	defer close(f.done)
+	for msg := range f.queue {
+		if msg.flushed != nil {
+			msg.flushed <- f.flush()
+			continue
+		}
+		f.write(msg.data)
+		// 队列空闲时才刷新缓冲，高负载时合并写入
+		if len(f.queue) == 0 {
+			f.setErr(f.flush())
+		}
+	}
+	f.setErr(f.flush())
+	if f.file != nil {
+		f.setErr(f.file.Close())
+	}
+	if f.compress != nil {
+		close(f.compress)
+		<-f.compressed
+	}
+}
+
+// setErr 记录第一个错误，Close时返回
+func (f *FileLogger) setErr(err error) {
+	f.errMutex.Lock()
+	defer f.errMutex.Unlock()
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+}
+
+// flush 把缓冲写入文件，失败时缓冲中的日志计为丢弃，并换用新的缓冲，
+// 避免bufio.Writer记住错误导致之后的写入全部失败
+func (f *FileLogger) flush() error {
+	if f.writer == nil {
+		return nil
+	}
+	err := f.writer.Flush()
+	if err != nil {
+		f.drop(f.buffered)
+		f.writer = bufio.NewWriter(f.file)
+	}
+	f.buffered = 0
+	return err
+}
+
+func (f *FileLogger) write(data []byte) {
+	if f.file != nil && f.shouldRotate(int64(len(data))) {
+		f.setErr(f.rotate())
+	}
+	// 之前打开文件失败时重试
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			f.setErr(err)
+			f.drop(1)
+			return
+		}
+	}
+	n, err := f.writer.Write(data)
+	if err != nil {
+		f.setErr(err)
+		f.drop(f.buffered + 1)
+		f.buffered = 0
+		f.writer = bufio.NewWriter(f.file)
+		return
+	}
+	f.size += int64(n)
+	f.buffered++
+}
+
+func (f *FileLogger) shouldRotate(next int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.options.MaxSize > 0 && f.size+next > f.options.MaxSize {
+		return true
+	}
+	return f.options.RotateEvery > 0 && f.now().Sub(f.openedAt) >= f.options.RotateEvery
+}
+
+// open 以追加模式打开日志文件
+func (f *FileLogger) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.filename), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.writer = bufio.NewWriter(file)
+	f.size = fi.Size()
+	f.openedAt = f.now()
+	return nil
+}
+
+// rotate 把当前文件改名为带时间戳的旧文件，然后打开新文件并清理过期的旧文件。
+// 改名失败时重新打开原来的文件继续写入，打开失败时由write在下一次写入时重试
+func (f *FileLogger) rotate() error {
+	if err := f.flush(); err != nil {
+		return err
+	}
+	closeErr := f.file.Close()
+	f.file, f.writer = nil, nil
+
+	backup := f.backupName(f.now().UTC())
+	renameErr := f.rename(f.filename, backup)
+	if err := f.open(); err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	if f.compress != nil {
+		f.compress <- backup
+		return nil
+	}
+	return f.removeExpired()
+}
+
+// runCompress 依次压缩旧文件，压缩完成后清理过期的旧文件
+func (f *FileLogger) runCompress() {
+	defer close(f.compressed)
+	for backup := range f.compress {
+		f.setErr(gzipFile(backup))
+		f.setErr(f.removeExpired())
+	}
+}
+
+// backupName 返回形如 access-20190101T000000.000.log 的文件名，
+// 同一毫秒内多次轮转时顺延时间戳，避免覆盖已有的文件
+func (f *FileLogger) backupName(t time.Time) string {
+	ext := filepath.Ext(f.filename)
+	prefix := strings.TrimSuffix(f.filename, ext)
+	for {
+		name := prefix + "-" + t.Format(backupTimeFormat) + ext
+		if !fileExists(name) && !fileExists(name+".gz") {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// backups 返回所有旧文件，从新到旧排列
+func (f *FileLogger) backups() ([]string, error) {
+	dir := filepath.Dir(f.filename)
+	ext := filepath.Ext(f.filename)
+	prefix := strings.TrimSuffix(filepath.Base(f.filename), ext) + "-"
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, fi := range infos {
+		name := fi.Name()
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		if fi.IsDir() || !strings.HasPrefix(stamp, prefix) {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(stamp, prefix)); err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	// 时间戳格式保证了按文件名排序就是按时间排序
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	for i := range names {
+		names[i] = filepath.Join(dir, names[i])
+	}
+	return names, nil
+}
+
+// removeExpired 删除超过数量或时间限制的旧文件
+func (f *FileLogger) removeExpired() error {
+	if f.options.MaxBackups <= 0 && f.options.MaxAge <= 0 {
+		return nil
+	}
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	ext := filepath.Ext(f.filename)
+	prefix := strings.TrimSuffix(filepath.Base(f.filename), ext) + "-"
+	for i, name := range backups {
+		expired := f.options.MaxBackups > 0 && i >= f.options.MaxBackups
+		if !expired && f.options.MaxAge > 0 {
+			stamp := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(name), ".gz"), ext)
+			t, _ := time.Parse(backupTimeFormat, strings.TrimPrefix(stamp, prefix))
+			expired = f.now().Sub(t) > f.options.MaxAge
+		}
+		if expired {
+			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// gzipFile 把name压缩为name.gz并删除原文件，压缩过程中写入的是临时文件，
+// 所以清理旧文件时不会看到压缩了一半的文件
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := name + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, name+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,209 @@
+package negroni
+
+import (
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFileLoggerDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "negroni-filelogger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func readFile(t *testing.T, name string) string {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFileLoggerWritesAndCloses(t *testing.T) {
+	dir := newFileLoggerDir(t)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "logs", "access.log")
+
+	f, err := NewFileLogger(name, FileLoggerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLogger()
+	l.ALogger = f
+	l.SetFormat("{{.Method}} {{.Path}} {{.Status}}")
+
+	n := New(l)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	}))
+	n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a", nil))
+	f.Printf("no newline %d", 1)
+
+	expect(t, f.Flush(), nil)
+	expect(t, readFile(t, name), "GET /a 200\nno newline 1\n")
+
+	f.Println("last")
+	expect(t, f.Close(), nil)
+	expect(t, readFile(t, name), "GET /a 200\nno newline 1\nlast\n")
+
+	// 关闭后的日志被丢弃并计数
+	f.Println("dropped")
+	expect(t, f.Dropped(), uint64(1))
+	expect(t, f.Close(), os.ErrClosed)
+}
+
+func TestFileLoggerRotateBySize(t *testing.T) {
+	dir := newFileLoggerDir(t)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.log")
+
+	f, err := NewFileLogger(name, FileLoggerOptions{MaxSize: 10, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first", "second", "third", "fourth"} {
+		f.Println(line)
+		f.Flush()
+	}
+	expect(t, f.Close(), nil)
+	expect(t, readFile(t, name), "fourth\n")
+
+	backups, err := f.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, len(backups), 2)
+	expect(t, strings.HasSuffix(backups[0], ".log.gz"), true)
+
+	file, err := os.Open(backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(gz)
+	expect(t, string(data), "third\n")
+}
+
+func TestFileLoggerRotateByTime(t *testing.T) {
+	dir := newFileLoggerDir(t)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.log")
+
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	f, err := NewFileLogger(name, FileLoggerOptions{RotateEvery: time.Hour, MaxAge: 30 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.now = func() time.Time { return now }
+	f.openedAt = now
+
+	f.Println("one")
+	f.Flush()
+	now = now.Add(time.Hour)
+	f.Println("two")
+	f.Flush()
+	now = now.Add(time.Hour)
+	f.Println("three")
+	expect(t, f.Close(), nil)
+
+	backups, err := f.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 第一个旧文件已经超过MaxAge
+	expect(t, len(backups), 1)
+	expect(t, filepath.Base(backups[0]), "app-20190101T020000.000.log")
+	expect(t, readFile(t, backups[0]), "two\n")
+	expect(t, readFile(t, name), "three\n")
+}
+
+func TestFileLoggerRotateFailure(t *testing.T) {
+	dir := newFileLoggerDir(t)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.log")
+
+	f, err := NewFileLogger(name, FileLoggerOptions{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	renameErr := errors.New("rename failed")
+	f.rename = func(oldpath, newpath string) error { return renameErr }
+
+	// 改名失败后继续写入原来的文件，日志不会丢失
+	for _, line := range []string{"first", "second", "third"} {
+		f.Println(line)
+		expect(t, f.Flush(), nil)
+	}
+	expect(t, f.Close(), renameErr)
+	expect(t, f.Dropped(), uint64(0))
+	expect(t, readFile(t, name), "first\nsecond\nthird\n")
+}
+
+func TestFileLoggerReopenFailure(t *testing.T) {
+	dir := newFileLoggerDir(t)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.log")
+
+	f, err := NewFileLogger(name, FileLoggerOptions{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 改名后原路径被目录占用，新文件无法打开
+	f.rename = func(oldpath, newpath string) error {
+		if err := os.Rename(oldpath, newpath); err != nil {
+			return err
+		}
+		return os.Mkdir(oldpath, 0755)
+	}
+	f.Println("first")
+	f.Flush()
+	f.Println("second")
+	f.Flush()
+	f.Println("third")
+	f.Flush()
+	expect(t, f.Dropped(), uint64(2))
+
+	// 路径恢复后重新打开文件继续写入
+	os.Remove(name)
+	f.Println("fourth")
+	expect(t, f.Close() != nil, true)
+	expect(t, readFile(t, name), "fourth\n")
+}
+
+func TestFileLoggerDropsOnOverflow(t *testing.T) {
+	dir := newFileLoggerDir(t)
+	defer os.RemoveAll(dir)
+
+	f := &FileLogger{
+		filename: filepath.Join(dir, "app.log"),
+		queue:    make(chan fileLogMessage, 2),
+		done:     make(chan struct{}),
+		now:      time.Now,
+	}
+	if err := f.open(); err != nil {
+		t.Fatal(err)
+	}
+	// 写入goroutine还没有启动，队列满后的日志会被丢弃
+	for i := 0; i < 5; i++ {
+		f.Println(i)
+	}
+	expect(t, f.Dropped(), uint64(3))
+
+	go f.run()
+	expect(t, f.Close(), nil)
+	expect(t, readFile(t, f.filename), "0\n1\n")
+}
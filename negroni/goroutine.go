@@ -0,0 +1,77 @@
+package negroni
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+)
+
+// recoveryContextKey 是Recovery保存在request context中的key
+type recoveryContextKey struct{}
+
+// fallbackRecovery 在request没有经过Recovery中间件时使用
+var fallbackRecovery = &Recovery{
+	Logger:    log.New(os.Stdout, "[negroni]", 0),
+	LogStack:  true,
+	StackSize: 1024 * 8,
+}
+
+// RecoveryFromRequest 返回处理这个请求的Recovery中间件，不存在时返回nil
+func RecoveryFromRequest(r *http.Request) *Recovery {
+	if r == nil {
+		return nil
+	}
+	rec, _ := r.Context().Value(recoveryContextKey{}).(*Recovery)
+	return rec
+}
+
+// withRecovery 把rec保存到request的context中，以便Go找到它
+func withRecovery(r *http.Request, rec *Recovery) *http.Request {
+	if r == nil {
+		return nil
+	}
+	return r.WithContext(context.WithValue(r.Context(), recoveryContextKey{}, rec))
+}
+
+// Go 在一个新的goroutine中执行fn，fn中的panic会被恢复，
+// 并交给处理请求r的Recovery记录，包括日志、PanicHandlerFunc和crash报告。
+// 如果r没有经过Recovery中间件，panic只会被记录到标准输出
+func Go(r *http.Request, fn func()) {
+	rec := RecoveryFromRequest(r)
+	if rec == nil {
+		rec = fallbackRecovery
+	}
+	go rec.run(r, fn)
+}
+
+// Go 在一个新的goroutine中执行fn，fn中的panic由rec记录，r是发起这个goroutine的请求
+func (rec *Recovery) Go(r *http.Request, fn func()) {
+	go rec.run(r, fn)
+}
+
+func (rec *Recovery) run(r *http.Request, fn func()) {
+	defer func() {
+		err := recover()
+		// 没有连接可以中断，ErrAbortHandler在这里直接忽略
+		if err == nil || err == http.ErrAbortHandler {
+			return
+		}
+
+		stack := make([]byte, rec.StackSize)
+		stack = stack[:runtime.Stack(stack, rec.StackAll)]
+		infos := &PanicInformation{
+			RecoveredPanic: err,
+			Stack:          stack,
+			Request:        r,
+			Redaction:      rec.Redaction,
+			RequestID:      RequestIDFromRequest(r),
+			Spawned:        true,
+		}
+		infos.Status, infos.Message = rec.resolveStatus(err)
+		rec.reportPanic(infos, stack)
+	}()
+
+	fn()
+}
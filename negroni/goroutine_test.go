@@ -0,0 +1,102 @@
+package negroni
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer 是可以在多个goroutine中使用的bytes.Buffer
+type syncBuffer struct {
+	mutex sync.Mutex
+	buff  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buff.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buff.String()
+}
+
+func TestGoRecoversSpawnedPanic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "negroni-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buff syncBuffer
+	done := make(chan *PanicInformation, 1)
+	rec := NewRecovery()
+	rec.Logger = log.New(&buff, "", 0)
+	rec.CrashReporter = NewFileCrashReporter(dir)
+	rec.PaincHandlerFunc = func(infos *PanicInformation) { done <- infos }
+
+	n := New()
+	n.Use(rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		Go(r, func() {
+			panic("background")
+		})
+		rw.WriteHeader(http.StatusAccepted)
+	}))
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "http://localhost:3000/jobs", nil)
+	n.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusAccepted)
+
+	infos := <-done
+	expect(t, infos.RecoveredPanic, "background")
+	expect(t, infos.Spawned, true)
+	expect(t, infos.Request.URL.Path, "/jobs")
+	expect(t, infos.Status, http.StatusInternalServerError)
+	expect(t, strings.Contains(buff.String(), "PANIC: background"), true)
+
+	reports, err := ReadCrashReports(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, len(reports), 1)
+}
+
+func TestRecoveryFromRequest(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	expect(t, RecoveryFromRequest(req), (*Recovery)(nil))
+	expect(t, RecoveryFromRequest(nil), (*Recovery)(nil))
+
+	var found *Recovery
+	rec := NewRecovery()
+	n := New(rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		found = RecoveryFromRequest(r)
+	}))
+	n.ServeHTTP(httptest.NewRecorder(), req)
+	expect(t, found, rec)
+}
+
+func TestRecoveryGo(t *testing.T) {
+	done := make(chan *PanicInformation, 1)
+	rec := NewRecovery()
+	rec.Logger = log.New(&syncBuffer{}, "", 0)
+	rec.PaincHandlerFunc = func(infos *PanicInformation) { done <- infos }
+
+	rec.Go(nil, func() {
+		panic(&PanicError{Status: http.StatusBadGateway})
+	})
+	infos := <-done
+	expect(t, infos.Status, http.StatusBadGateway)
+	expect(t, infos.RequestDescription(), nilRequestMessage)
+}
@@ -0,0 +1,227 @@
+package negroni
+
+import (
+	"math/rand"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogRule 描述一类请求，所有非零的条件都满足时才算匹配
+type LogRule struct {
+	// Path 是path.Match格式的路径，以"/**"结尾时匹配该目录下的所有路径
+	Path string
+	// Method 是请求方法，不区分大小写
+	Method string
+	// StatusClass 是状态码的类别，例如2表示2xx
+	StatusClass int
+	// MinDuration 匹配处理时间不少于它的请求
+	MinDuration time.Duration
+}
+
+// Match 返回entry是否满足规则
+func (rule *LogRule) Match(entry *LoggerEntry) bool {
+	if rule.Path != "" && !matchPathGlob(rule.Path, entry.Path) {
+		return false
+	}
+	if rule.Method != "" && !strings.EqualFold(rule.Method, entry.Method) {
+		return false
+	}
+	if rule.StatusClass != 0 && entry.Status/100 != rule.StatusClass {
+		return false
+	}
+	return entry.Duration >= rule.MinDuration
+}
+
+// matchPathGlob 在path.Match的基础上支持以"/**"结尾的前缀匹配
+func matchPathGlob(pattern, name string) bool {
+	if strings.HasSuffix(pattern, "/**") {
+		prefix := strings.TrimSuffix(pattern, "**")
+		return strings.HasPrefix(name, prefix) || name == strings.TrimSuffix(prefix, "/")
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// LogFilterStats 是被LogFilter过滤掉的日志数量
+type LogFilterStats struct {
+	// Excluded 是没有被Include匹配或者被Exclude匹配的数量
+	Excluded uint64
+	// Sampled 是因为采样没有记录的数量
+	Sampled uint64
+}
+
+// Total 返回过滤掉的日志总数
+func (s LogFilterStats) Total() uint64 {
+	return s.Excluded + s.Sampled
+}
+
+// LogFilter 决定Logger记录哪些请求。
+// 出错(状态码不小于ErrorStatus)或处理时间不少于SlowThreshold的请求总是被记录，
+// 其他请求先经过Include和Exclude规则，成功的请求再按SampleRate采样
+type LogFilter struct {
+	// Include 不为空时只记录匹配其中任意一条规则的请求
+	Include []LogRule
+	// Exclude 是不记录的请求
+	Exclude []LogRule
+	// SampleRate 是2xx和3xx请求被记录的比例，取值0到1，为0时不采样
+	SampleRate float64
+	// ErrorStatus 是被当作错误的最小状态码，为0时使用500
+	ErrorStatus int
+	// SlowThreshold 是慢请求的阈值，为0时不判断
+	SlowThreshold time.Duration
+	// ReportInterval 是Logger输出过滤统计的间隔，为0时不输出。统计作为Phase为LogPhaseReport的日志
+	// 交给Logger的Formatter输出，CLF格式没有对应的行，不输出统计，可以使用OnReport
+	ReportInterval time.Duration
+	// OnReport 不为nil时，每次输出过滤统计都会用这段时间的统计和时长调用它，与Formatter无关。
+	// 它在请求的goroutine中调用，不能阻塞
+	OnReport func(stats LogFilterStats, elapsed time.Duration)
+
+	mutex      sync.Mutex
+	stats      LogFilterStats
+	total      LogFilterStats
+	lastReport time.Time
+	random     func() float64
+}
+
+// matchRequest 只比较Path和Method，用于请求还没有结束时
+func (rule *LogRule) matchRequest(entry *LoggerEntry) bool {
+	if rule.Path != "" && !matchPathGlob(rule.Path, entry.Path) {
+		return false
+	}
+	return rule.Method == "" || strings.EqualFold(rule.Method, entry.Method)
+}
+
+// Allow 返回是否应该记录entry，同时更新过滤统计
+func (f *LogFilter) Allow(entry *LoggerEntry) bool {
+	return f.allow(entry, f.rand)
+}
+
+// allow 与Allow相同，采样使用sample返回的随机数
+func (f *LogFilter) allow(entry *LoggerEntry, sample func() float64) bool {
+	if f.alwaysLog(entry) {
+		return true
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !f.included(entry) {
+		f.stats.Excluded++
+		f.total.Excluded++
+		return false
+	}
+	if f.sampling() && entry.Status < 400 && sample() >= f.SampleRate {
+		f.stats.Sampled++
+		f.total.Sampled++
+		return false
+	}
+	return true
+}
+
+func (f *LogFilter) alwaysLog(entry *LoggerEntry) bool {
+	errorStatus := f.ErrorStatus
+	if errorStatus == 0 {
+		errorStatus = 500
+	}
+	if entry.Status >= errorStatus {
+		return true
+	}
+	return f.SlowThreshold > 0 && entry.Duration >= f.SlowThreshold
+}
+
+func (f *LogFilter) included(entry *LoggerEntry) bool {
+	if len(f.Include) > 0 {
+		matched := false
+		for i := range f.Include {
+			if f.Include[i].Match(entry) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for i := range f.Exclude {
+		if f.Exclude[i].Match(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// allowStart 返回是否应该记录请求的开始日志，sample是请求开始时抽取的随机数，
+// 请求结束时用同一个随机数采样，这样开始和结束日志要么都记录，要么都不记录。
+// 只有Path和Method能在请求开始时判断，带StatusClass或MinDuration的Exclude规则不会排除开始日志。
+// 出错或慢请求的结束日志总是记录，但它们的开始日志可能已经被过滤。开始日志不计入过滤统计
+func (f *LogFilter) allowStart(entry *LoggerEntry, sample float64) bool {
+	if len(f.Include) > 0 {
+		matched := false
+		for i := range f.Include {
+			if f.Include[i].matchRequest(entry) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for i := range f.Exclude {
+		rule := &f.Exclude[i]
+		if rule.StatusClass == 0 && rule.MinDuration <= 0 && rule.matchRequest(entry) {
+			return false
+		}
+	}
+	return !f.sampling() || sample < f.SampleRate
+}
+
+// sampling 返回是否需要采样
+func (f *LogFilter) sampling() bool {
+	return f.SampleRate > 0 && f.SampleRate < 1
+}
+
+// draw 返回一个采样用的随机数
+func (f *LogFilter) draw() float64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.rand()
+}
+
+// rand 调用者必须持有锁
+func (f *LogFilter) rand() float64 {
+	if f.random == nil {
+		return rand.Float64()
+	}
+	return f.random()
+}
+
+// Stats 返回从创建以来过滤掉的日志数量
+func (f *LogFilter) Stats() LogFilterStats {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.total
+}
+
+// report 如果距离上次输出已经超过ReportInterval，返回这段时间的统计并清零
+func (f *LogFilter) report(now time.Time) (LogFilterStats, time.Duration, bool) {
+	if f.ReportInterval <= 0 {
+		return LogFilterStats{}, 0, false
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.lastReport.IsZero() {
+		f.lastReport = now
+		return LogFilterStats{}, 0, false
+	}
+	elapsed := now.Sub(f.lastReport)
+	if elapsed < f.ReportInterval {
+		return LogFilterStats{}, 0, false
+	}
+	stats := f.stats
+	f.stats = LogFilterStats{}
+	f.lastReport = now
+	return stats, elapsed, stats.Total() > 0
+}
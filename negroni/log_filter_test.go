@@ -0,0 +1,207 @@
+package negroni
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogRuleMatch(t *testing.T) {
+	entry := &LoggerEntry{Method: "GET", Path: "/static/css/app.css", Status: 200, Duration: 5 * time.Millisecond}
+
+	for _, rule := range []LogRule{
+		{Path: "/static/**"},
+		{Path: "/static/css/*.css"},
+		{Method: "get"},
+		{StatusClass: 2},
+		{MinDuration: 5 * time.Millisecond},
+		{Path: "/static/**", Method: "GET", StatusClass: 2},
+	} {
+		if !rule.Match(entry) {
+			t.Errorf("expected %+v to match", rule)
+		}
+	}
+	for _, rule := range []LogRule{
+		{Path: "/static/*"},
+		{Path: "/healthz"},
+		{Method: "POST"},
+		{StatusClass: 5},
+		{MinDuration: time.Second},
+		{Path: "/static/**", Method: "POST"},
+	} {
+		if rule.Match(entry) {
+			t.Errorf("expected %+v not to match", rule)
+		}
+	}
+}
+
+func TestLogFilterAllow(t *testing.T) {
+	f := &LogFilter{
+		Include:       []LogRule{{Path: "/api/**"}, {Path: "/healthz"}},
+		Exclude:       []LogRule{{Path: "/healthz"}},
+		SampleRate:    0.5,
+		SlowThreshold: time.Second,
+	}
+	samples := []float64{0.7, 0.2}
+	f.random = func() float64 {
+		v := samples[0]
+		samples = samples[1:]
+		return v
+	}
+
+	expect(t, f.Allow(&LoggerEntry{Path: "/healthz", Status: 200}), false)
+	expect(t, f.Allow(&LoggerEntry{Path: "/other", Status: 200}), false)
+	expect(t, f.Allow(&LoggerEntry{Path: "/healthz", Status: 503}), true)
+	expect(t, f.Allow(&LoggerEntry{Path: "/healthz", Status: 200, Duration: 2 * time.Second}), true)
+	expect(t, f.Allow(&LoggerEntry{Path: "/api/orders", Status: 200}), false)
+	expect(t, f.Allow(&LoggerEntry{Path: "/api/orders", Status: 200}), true)
+	// 4xx不参与采样
+	expect(t, f.Allow(&LoggerEntry{Path: "/api/orders", Status: 404}), true)
+
+	expect(t, f.Stats(), LogFilterStats{Excluded: 2, Sampled: 1})
+}
+
+func TestLogFilterReport(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &LogFilter{Exclude: []LogRule{{Path: "/healthz"}}, ReportInterval: time.Minute}
+
+	_, _, ok := f.report(now)
+	expect(t, ok, false)
+	f.Allow(&LoggerEntry{Path: "/healthz", Status: 200})
+	_, _, ok = f.report(now.Add(30 * time.Second))
+	expect(t, ok, false)
+
+	stats, elapsed, ok := f.report(now.Add(time.Minute))
+	expect(t, ok, true)
+	expect(t, elapsed, time.Minute)
+	expect(t, stats.Excluded, uint64(1))
+
+	_, _, ok = f.report(now.Add(3 * time.Minute))
+	expect(t, ok, false)
+	expect(t, f.Stats().Excluded, uint64(1))
+}
+
+func TestLoggerFilter(t *testing.T) {
+	var buff bytes.Buffer
+	l := NewLogger()
+	l.ALogger = log.New(&buff, "", 0)
+	l.SetFormat("{{.Path}} {{.Status}}")
+	l.Filter = &LogFilter{Exclude: []LogRule{{Path: "/healthz"}, {Path: "/static/**"}}}
+
+	n := New(l)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/static/broken.js" {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+	for _, p := range []string{"/healthz", "/static/app.js", "/static/broken.js", "/orders"} {
+		n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", p, nil))
+	}
+
+	expect(t, strings.TrimSpace(buff.String()), "/static/broken.js 500\n/orders 200")
+	expect(t, l.Filter.Stats().Total(), uint64(2))
+}
+
+func TestLoggerFilterStartEntries(t *testing.T) {
+	var buff bytes.Buffer
+	l := NewLogger()
+	l.ALogger = log.New(&buff, "", 0)
+	l.SetFormat("{{.Phase}} {{.Path}} {{.Status}}")
+	l.LogStart = true
+	l.Filter = &LogFilter{
+		Include:    []LogRule{{Path: "/api/**"}},
+		Exclude:    []LogRule{{Path: "/api/healthz"}, {Path: "/api/**", StatusClass: 4}},
+		SampleRate: 0.5,
+	}
+	samples := []float64{0.9, 0.9, 0.7, 0.2, 0.1}
+	l.Filter.random = func() float64 {
+		v := samples[0]
+		samples = samples[1:]
+		return v
+	}
+
+	n := New(l)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/missing" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+	for _, p := range []string{"/other", "/api/healthz", "/api/sampled", "/api/orders", "/api/missing"} {
+		n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", p, nil))
+	}
+
+	// 开始日志和结束日志使用同一个采样结果，请求开始时不知道状态码，StatusClass规则不排除开始日志
+	expect(t, strings.TrimSpace(buff.String()), "start /api/orders 0\n /api/orders 200\nstart /api/missing 0")
+	expect(t, l.Filter.Stats(), LogFilterStats{Excluded: 3, Sampled: 1})
+}
+
+func TestLoggerFilterReportIsStructured(t *testing.T) {
+	var buff bytes.Buffer
+	l := NewLogger()
+	l.ALogger = log.New(&buff, "", 0)
+	l.Formatter = &JSONLogFormatter{}
+	l.Filter = &LogFilter{Exclude: []LogRule{{Path: "/healthz"}}, ReportInterval: time.Nanosecond}
+
+	n := New(l)
+	for _, p := range []string{"/healthz", "/healthz", "/orders"} {
+		n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", p, nil))
+	}
+
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	expect(t, len(lines), 3)
+	var report map[string]interface{}
+	for _, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line is not json: %q", line)
+		}
+		if entry["phase"] == LogPhaseReport {
+			report = entry
+		}
+	}
+	expect(t, report[LogFieldSuppressed], float64(1))
+	expect(t, report[LogFieldExcluded], float64(1))
+	expect(t, report[LogFieldSampled], float64(0))
+	_, hasPath := report["path"]
+	expect(t, hasPath, false)
+
+	// 模板格式输出一行固定格式的统计
+	buff.Reset()
+	l.SetFormat("{{.Path}}")
+	l.Filter = &LogFilter{Exclude: []LogRule{{Path: "/healthz"}}, ReportInterval: time.Nanosecond}
+	for _, p := range []string{"/healthz", "/healthz", "/orders"} {
+		n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", p, nil))
+	}
+	lines = strings.Split(strings.TrimSpace(buff.String()), "\n")
+	expect(t, len(lines), 3)
+	expect(t, strings.Contains(lines[0], " suppressed 1 log lines in the last "), true)
+	expect(t, strings.HasSuffix(lines[0], "(excluded 1, sampled out 0)"), true)
+	expect(t, lines[2], "/orders")
+
+	// CLF格式没有对应的行，统计只交给OnReport
+	buff.Reset()
+	l.Formatter = &CommonLogFormatter{}
+	var reported []LogFilterStats
+	l.Filter = &LogFilter{
+		Exclude:        []LogRule{{Path: "/healthz"}},
+		ReportInterval: time.Nanosecond,
+		OnReport: func(stats LogFilterStats, elapsed time.Duration) {
+			reported = append(reported, stats)
+		},
+	}
+	for _, p := range []string{"/healthz", "/healthz", "/orders"} {
+		n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", p, nil))
+	}
+	expect(t, strings.Count(buff.String(), "\n"), 1)
+	expect(t, len(reported), 2)
+	expect(t, reported[0], LogFilterStats{Excluded: 1})
+}
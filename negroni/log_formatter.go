@@ -0,0 +1,212 @@
+package negroni
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// LogFormatter 把一条LoggerEntry格式化为一行日志
+type LogFormatter interface {
+	FormatLog(entry *LoggerEntry) (string, error)
+}
+
+// TemplateLogFormatter 使用text/template格式化日志，这是Logger的默认模式
+type TemplateLogFormatter struct {
+	Template *template.Template
+}
+
+// FormatLog 实现LogFormatter接口方法，LogPhaseReport统计不经过模板，输出为一行固定格式的文本
+func (f *TemplateLogFormatter) FormatLog(entry *LoggerEntry) (string, error) {
+	if entry.Phase == LogPhaseReport {
+		return fmt.Sprintf("%s suppressed %v log lines in the last %s (excluded %v, sampled out %v)",
+			entry.StartTime, logFieldValue(entry, LogFieldSuppressed), entry.Duration.Round(time.Second),
+			logFieldValue(entry, LogFieldExcluded), logFieldValue(entry, LogFieldSampled)), nil
+	}
+	buff := &bytes.Buffer{}
+	err := f.Template.Execute(buff, entry)
+	return buff.String(), err
+}
+
+// logFieldValue 返回entry.Fields中名为name的值，没有时返回nil
+func logFieldValue(entry *LoggerEntry, name string) interface{} {
+	for _, field := range entry.Fields {
+		if field.Name == name {
+			return field.Value
+		}
+	}
+	return nil
+}
+
+// LogField 是从请求中额外读取、输出到每一行日志的字段
+// Header和ContextKey只需要设置一个，都设置时优先使用Header
+type LogField struct {
+	// Name 是输出时使用的字段名，与固定字段(LogFieldTime等)同名时在结构化日志中输出为 "extra_"+Name
+	Name string
+	// Header 是读取值的请求header
+	Header string
+	// ContextKey 是读取值的request context key
+	ContextKey interface{}
+}
+
+// LogFieldValue 是LogField在一次请求中的取值
+type LogFieldValue struct {
+	Name  string
+	Value interface{}
+}
+
+// 结构化日志中固定字段的名称，修改它们会破坏下游的日志解析
+const (
+	LogFieldTime       = "time"
+	LogFieldStatus     = "status"
+	LogFieldDurationMs = "duration_ms"
+	LogFieldMethod     = "method"
+	LogFieldPath       = "path"
+	LogFieldHost       = "host"
+	LogFieldSize       = "size"
+	LogFieldRequestID  = "request_id"
+	LogFieldPhase      = "phase"
+	LogFieldSlow       = "slow"
+)
+
+// structuredFields 返回结构化日志的所有字段，固定字段在前，额外字段按配置顺序在后
+// request_id、phase和slow只在有值时输出，LogPhaseReport只输出时间、时长、阶段和统计字段
+func structuredFields(entry *LoggerEntry) []LogFieldValue {
+	if entry.Phase == LogPhaseReport {
+		return append([]LogFieldValue{
+			{LogFieldTime, entry.StartTime},
+			{LogFieldDurationMs, float64(entry.Duration) / float64(time.Millisecond)},
+			{LogFieldPhase, entry.Phase},
+		}, entry.Fields...)
+	}
+	fields := []LogFieldValue{
+		{LogFieldTime, entry.StartTime},
+		{LogFieldStatus, entry.Status},
+		{LogFieldDurationMs, float64(entry.Duration) / float64(time.Millisecond)},
+		{LogFieldMethod, entry.Method},
+		{LogFieldPath, entry.Path},
+		{LogFieldHost, entry.HostName},
+		{LogFieldSize, entry.Size},
+	}
+	if entry.RequestID != "" {
+		fields = append(fields, LogFieldValue{LogFieldRequestID, entry.RequestID})
+	}
+	if entry.Phase != "" {
+		fields = append(fields, LogFieldValue{LogFieldPhase, entry.Phase})
+	}
+	if entry.Slow {
+		fields = append(fields, LogFieldValue{LogFieldSlow, true})
+	}
+	for _, field := range entry.Fields {
+		if reservedLogFields[field.Name] {
+			field.Name = extraLogFieldPrefix + field.Name
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// extraLogFieldPrefix 是与固定字段同名的额外字段输出时使用的前缀
+const extraLogFieldPrefix = "extra_"
+
+// reservedLogFields 是固定字段的名称，额外字段不能使用它们，否则会输出重复的key
+var reservedLogFields = map[string]bool{
+	LogFieldTime:       true,
+	LogFieldStatus:     true,
+	LogFieldDurationMs: true,
+	LogFieldMethod:     true,
+	LogFieldPath:       true,
+	LogFieldHost:       true,
+	LogFieldSize:       true,
+	LogFieldRequestID:  true,
+	LogFieldPhase:      true,
+	LogFieldSlow:       true,
+}
+
+// JSONLogFormatter 把每个请求输出为一个json对象，字段顺序固定
+type JSONLogFormatter struct{}
+
+// FormatLog 实现LogFormatter接口方法
+func (f *JSONLogFormatter) FormatLog(entry *LoggerEntry) (string, error) {
+	buff := &bytes.Buffer{}
+	buff.WriteByte('{')
+	for i, field := range structuredFields(entry) {
+		if i > 0 {
+			buff.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.Name)
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			// 无法编码的值退化为它的文本形式
+			value, _ = json.Marshal(fmt.Sprint(field.Value))
+		}
+		buff.Write(key)
+		buff.WriteByte(':')
+		buff.Write(value)
+	}
+	buff.WriteByte('}')
+	return buff.String(), nil
+}
+
+// LogfmtLogFormatter 把每个请求输出为一行logfmt格式的 key=value 对
+type LogfmtLogFormatter struct{}
+
+// FormatLog 实现LogFormatter接口方法
+func (f *LogfmtLogFormatter) FormatLog(entry *LoggerEntry) (string, error) {
+	buff := &bytes.Buffer{}
+	for i, field := range structuredFields(entry) {
+		if i > 0 {
+			buff.WriteByte(' ')
+		}
+		buff.WriteString(logfmtKey(field.Name))
+		buff.WriteByte('=')
+		buff.WriteString(logfmtValue(field.Value))
+	}
+	return buff.String(), nil
+}
+
+// logfmtKey 把key中不允许出现的字符替换为下划线
+func logfmtKey(key string) string {
+	if key == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// logfmtValue 返回值的logfmt形式，包含空格、引号、等号或控制字符时加引号并转义
+func logfmtValue(v interface{}) string {
+	var s string
+	switch value := v.(type) {
+	case string:
+		s = value
+	case int:
+		return strconv.Itoa(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', 3, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case nil:
+		return ""
+	default:
+		s = fmt.Sprint(value)
+	}
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
@@ -0,0 +1,111 @@
+package negroni
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type tenantKey struct{}
+
+func newFormatterEntry() *LoggerEntry {
+	req, _ := http.NewRequest("GET", "http://example.com/a", nil)
+	return &LoggerEntry{
+		StartTime: "2019-01-01T00:00:00Z",
+		Status:    http.StatusCreated,
+		Duration:  1500 * time.Microsecond,
+		HostName:  "example.com",
+		Method:    "GET",
+		Path:      "/a\"} \n{\"evil\":1 x=y",
+		Size:      12,
+		Request:   req,
+		Fields: []LogFieldValue{
+			{Name: "tenant", Value: "acme corp"},
+			{Name: "missing", Value: nil},
+		},
+	}
+}
+
+func TestJSONLogFormatter(t *testing.T) {
+	line, err := (&JSONLogFormatter{}).FormatLog(newFormatterEntry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, strings.Contains(line, "\n"), false)
+	expect(t, strings.HasPrefix(line, `{"time":"2019-01-01T00:00:00Z","status":201,"duration_ms":1.5,"method":"GET"`), true)
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, decoded["status"], float64(201))
+	expect(t, decoded["size"], float64(12))
+	expect(t, decoded["path"], "/a\"} \n{\"evil\":1 x=y")
+	expect(t, decoded["tenant"], "acme corp")
+	expect(t, decoded["missing"], nil)
+	_, ok := decoded["evil"]
+	expect(t, ok, false)
+}
+
+func TestLogfmtLogFormatter(t *testing.T) {
+	line, err := (&LogfmtLogFormatter{}).FormatLog(newFormatterEntry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, line, `time=2019-01-01T00:00:00Z status=201 duration_ms=1.500 method=GET `+
+		`path="/a\"} \n{\"evil\":1 x=y" host=example.com size=12 tenant="acme corp" missing=`)
+}
+
+func TestLoggerStructuredFields(t *testing.T) {
+	var buff bytes.Buffer
+	l := NewLogger()
+	l.ALogger = log.New(&buff, "", 0)
+	l.Formatter = &JSONLogFormatter{}
+	l.Fields = []LogField{
+		{Name: "request_id", Header: "X-Request-Id"},
+		{Name: "tenant", ContextKey: tenantKey{}},
+		{Name: "auth", Header: "Authorization"},
+		{Name: "status", Header: "X-Status"},
+	}
+
+	n := New()
+	n.Use(l)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("hello"))
+	}))
+
+	req, _ := http.NewRequest("GET", "http://localhost:3000/foo", nil)
+	req.Header.Set("X-Request-Id", "abc")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Status", "spoofed")
+	req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "acme"))
+	n.ServeHTTP(httptest.NewRecorder(), req)
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buff.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, decoded["status"], float64(200))
+	expect(t, decoded["size"], float64(5))
+	expect(t, decoded["path"], "/foo")
+	expect(t, decoded["host"], "localhost:3000")
+	expect(t, decoded["tenant"], "acme")
+	expect(t, decoded["auth"], DefaultRedactionMask)
+	// 与固定字段同名的额外字段加上前缀，不会输出重复的key
+	expect(t, decoded["request_id"], nil)
+	expect(t, decoded["extra_request_id"], "abc")
+	expect(t, decoded["extra_status"], "spoofed")
+	expect(t, strings.Count(buff.String(), `"status":`), 1)
+
+	buff.Reset()
+	l.Formatter = &LogfmtLogFormatter{}
+	n.ServeHTTP(httptest.NewRecorder(), req)
+	expect(t, strings.Contains(buff.String(), " status=200 "), true)
+	expect(t, strings.Contains(buff.String(), " extra_status=spoofed"), true)
+}
@@ -0,0 +1,188 @@
+package negroni
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// ANSI颜色，用于终端输出
+const (
+	colorReset   = "\033[0m"
+	colorRed     = "\033[31m"
+	colorGreen   = "\033[32m"
+	colorYellow  = "\033[33m"
+	colorBlue    = "\033[34m"
+	colorMagenta = "\033[35m"
+	colorCyan    = "\033[36m"
+	colorBold    = "\033[1m"
+)
+
+// LoggerFuncMap 是Logger模板中可以使用的函数
+//
+//	header     {{header .Request "X-Forwarded-For"}}  读取请求header
+//	query      {{query .Request "page"}}              读取query参数
+//	ms         {{ms .Duration}}                       以毫秒为单位的耗时
+//	durationIn {{durationIn .Duration "s"}}           以ns、us、ms或s为单位的耗时
+//	padLeft    {{.Status | padLeft 5}}                左侧补空格到指定宽度
+//	padRight   {{.Path | padRight 30}}                右侧补空格到指定宽度
+//	colorStatus {{colorStatus .Status}}               按状态码类别着色的状态码
+//	colorByStatus {{colorByStatus .Status .Path}}     按状态码类别给任意文本着色
+//	anonymizeIP {{anonymizeIP .RemoteAddr}}           隐藏IP的主机部分
+var LoggerFuncMap = template.FuncMap{
+	"header":        templateHeader,
+	"query":         templateQuery,
+	"ms":            func(d time.Duration) (string, error) { return formatDurationIn(d, "ms") },
+	"durationIn":    formatDurationIn,
+	"padLeft":       padLeft,
+	"padRight":      padRight,
+	"colorStatus":   func(status int) string { return colorByStatus(status, status) },
+	"colorByStatus": colorByStatus,
+	"anonymizeIP":   AnonymizeIP,
+}
+
+func templateHeader(r *http.Request, name string) string {
+	if r == nil {
+		return ""
+	}
+	return r.Header.Get(name)
+}
+
+func templateQuery(r *http.Request, name string) string {
+	if r == nil || r.URL == nil {
+		return ""
+	}
+	return r.URL.Query().Get(name)
+}
+
+// formatDurationIn 把d格式化为指定单位的数值，保留三位小数
+func formatDurationIn(d time.Duration, unit string) (string, error) {
+	var base time.Duration
+	switch unit {
+	case "ns":
+		return fmt.Sprintf("%d", d.Nanoseconds()), nil
+	case "us", "µs":
+		base = time.Microsecond
+	case "ms":
+		base = time.Millisecond
+	case "s":
+		base = time.Second
+	default:
+		return "", fmt.Errorf("unknown duration unit %q", unit)
+	}
+	return fmt.Sprintf("%.3f", float64(d)/float64(base)), nil
+}
+
+func padLeft(width int, v interface{}) string {
+	s := fmt.Sprint(v)
+	if n := width - utf8.RuneCountInString(s); n > 0 {
+		return strings.Repeat(" ", n) + s
+	}
+	return s
+}
+
+func padRight(width int, v interface{}) string {
+	s := fmt.Sprint(v)
+	if n := width - utf8.RuneCountInString(s); n > 0 {
+		return s + strings.Repeat(" ", n)
+	}
+	return s
+}
+
+// statusColor 返回状态码类别对应的颜色
+func statusColor(status int) string {
+	switch {
+	case status >= 500:
+		return colorRed
+	case status >= 400:
+		return colorYellow
+	case status >= 300:
+		return colorCyan
+	case status >= 200:
+		return colorGreen
+	default:
+		return colorMagenta
+	}
+}
+
+func colorByStatus(status int, v interface{}) string {
+	return statusColor(status) + fmt.Sprint(v) + colorReset
+}
+
+// AnonymizeIP 把IPv4地址的最后一段、IPv6地址/48之后的部分置零，
+// 不是IP的输入原样返回
+func AnonymizeIP(addr string) string {
+	host := remoteIP(addr)
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return addr
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// SampleLoggerEntry 返回一个包含所有字段的示例LoggerEntry，用于检查日志格式
+func SampleLoggerEntry() *LoggerEntry {
+	start := time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC)
+	u, _ := url.Parse("http://example.com/orders/42?page=2")
+	req := &http.Request{
+		Method:     "GET",
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"User-Agent": {"Mozilla/5.0"},
+			"Referer":    {"http://example.com/"},
+		},
+		Host:       "example.com",
+		RemoteAddr: "203.0.113.7:51234",
+		RequestURI: "/orders/42?page=2",
+	}
+	return &LoggerEntry{
+		Start:      start,
+		StartTime:  start.Format(LoggerDefaultDateFormat),
+		Status:     http.StatusOK,
+		Duration:   12345 * time.Microsecond,
+		HostName:   "example.com",
+		Method:     "GET",
+		Path:       "/orders/42",
+		Size:       512,
+		RemoteAddr: "203.0.113.7",
+		Referer:    "http://example.com/",
+		UserAgent:  "Mozilla/5.0",
+		Proto:      "HTTP/1.1",
+		RequestID:  "0f8fad5b-d9cb-469f-a165-70867728950e",
+		Request:    req,
+	}
+}
+
+// ParseLogFormat 解析Logger的模板格式，模板中可以使用LoggerFuncMap中的函数。
+// 解析成功后还会用SampleLoggerEntry执行一次，以便提前发现引用了不存在字段之类的错误
+func ParseLogFormat(format string) (*template.Template, error) {
+	tpl, err := template.New("negroni_parser").Funcs(LoggerFuncMap).Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	if err := tpl.Execute(&bytes.Buffer{}, SampleLoggerEntry()); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// DryRunLogFormat 用SampleLoggerEntry渲染format，返回一行日志的样子
+func DryRunLogFormat(format string) (string, error) {
+	tpl, err := ParseLogFormat(format)
+	if err != nil {
+		return "", err
+	}
+	return (&TemplateLogFormatter{Template: tpl}).FormatLog(SampleLoggerEntry())
+}
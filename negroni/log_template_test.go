@@ -0,0 +1,71 @@
+package negroni
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoggerSetFormatError(t *testing.T) {
+	l := NewLogger()
+	l.SetFormat("{{.Path}}")
+	before := l.Formatter
+
+	refute(t, l.SetFormat("{{.Path"), nil)
+	refute(t, l.SetFormat("{{.NoSuchField}}"), nil)
+	refute(t, l.SetFormat(`{{durationIn .Duration "hours"}}`), nil)
+	expect(t, l.Formatter, before)
+	expect(t, l.SetFormat("{{.Method}}"), nil)
+}
+
+func TestDryRunLogFormat(t *testing.T) {
+	line, err := DryRunLogFormat(`{{anonymizeIP .RemoteAddr}} {{.Method | padRight 6}}|{{.Status | padLeft 5}} ` +
+		`{{ms .Duration}} {{durationIn .Duration "s"}} {{header .Request "User-Agent"}} {{query .Request "page"}}`)
+	expect(t, err, nil)
+	expect(t, line, "203.0.113.0 GET   |  200 12.345 0.012 Mozilla/5.0 2")
+
+	line, err = DryRunLogFormat(`{{colorStatus .Status}} {{colorByStatus 503 "down"}}`)
+	expect(t, err, nil)
+	expect(t, line, "\033[32m200\033[0m \033[31mdown\033[0m")
+
+	_, err = DryRunLogFormat("{{.Missing}}")
+	refute(t, err, nil)
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	expect(t, AnonymizeIP("192.168.10.25"), "192.168.10.0")
+	expect(t, AnonymizeIP("192.168.10.25:8080"), "192.168.10.0")
+	expect(t, AnonymizeIP("2001:db8:85a3:8d3:1319:8a2e:370:7348"), "2001:db8:85a3::")
+	expect(t, AnonymizeIP("not an ip"), "not an ip")
+}
+
+func TestLoggerTemplateExecuteError(t *testing.T) {
+	var buff bytes.Buffer
+	l := NewLogger()
+	l.ALogger = log.New(&buff, "", 0)
+	// 示例中有Referer，实际请求中没有时会在执行时出错
+	expect(t, l.SetFormat(`{{index .Request.Header.Referer 0}}`), nil)
+
+	n := New(l)
+	n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	// 错误不会写入日志流，只计数
+	expect(t, buff.String(), "")
+	expect(t, l.FormatErrors(), uint64(1))
+}
+
+func TestLoggerFuncMapInRequest(t *testing.T) {
+	var buff bytes.Buffer
+	l := NewLogger()
+	l.ALogger = log.New(&buff, "", 0)
+	expect(t, l.SetFormat(`{{header .Request "X-Forwarded-For"}} {{query .Request "q"}}`), nil)
+
+	n := New(l)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/search?q=go", nil)
+	req.Header.Set("X-Forwarded-For", "10.1.1.1")
+	n.ServeHTTP(httptest.NewRecorder(), req)
+	expect(t, strings.TrimSpace(buff.String()), "10.1.1.1 go")
+}
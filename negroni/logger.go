@@ -1,25 +1,66 @@
 package negroni
 
 import (
-	"bytes"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"text/template"
+	"sync/atomic"
 	"time"
 )
 
 // LoggerEntry 是传递给模板的结构
+// Path和Request已经按Logger的脱敏策略隐藏了敏感信息
 type LoggerEntry struct {
+	// Start 是请求开始的时间，StartTime是它按Logger的时间格式格式化后的文本
+	Start     time.Time
 	StartTime string
 	Status    int
 	Duration  time.Duration
 	HostName  string
 	Method    string
 	Path      string
+	// Size 是response body的字节数
+	Size int
+	// RemoteAddr 是客户端的IP，不包含端口
+	RemoteAddr string
+	// User 是basic auth中的用户名，没有时为空
+	User      string
+	Referer   string
+	UserAgent string
+	Proto     string
+	// RequestID 是RequestID中间件设置的请求ID
+	RequestID string
 	Request   *http.Request
+	// Fields 是Logger.Fields中配置的额外字段的取值
+	Fields []LogFieldValue
+	// Phase 是日志所处的阶段，请求结束时的日志为空
+	Phase string
+	// Slow 表示请求处理时间超过了Logger.SlowThreshold
+	Slow bool
+	// RequestBody 和 ResponseBody 是body开头的片段，只有Formatter实现了BodyCapturer时才有值
+	RequestBody  []byte
+	ResponseBody []byte
 }
 
+// LoggerEntry.Phase 的取值
+const (
+	// LogPhaseStart 是请求进入时输出的日志
+	LogPhaseStart = "start"
+	// LogPhaseRunning 是请求处理超时仍未结束时输出的警告
+	LogPhaseRunning = "running"
+	// LogPhaseReport 是LogFilter定期输出的过滤统计，不对应任何请求，
+	// Duration是统计的时间段，Fields中是各项数量
+	LogPhaseReport = "report"
+)
+
+// 过滤统计日志中各项数量的字段名
+const (
+	LogFieldSuppressed = "suppressed"
+	LogFieldExcluded   = "excluded"
+	LogFieldSampled    = "sampled"
+)
+
 // LoggerDefaultDateFormat 是被用作默认的logger 时间格式
 var LoggerDefaultDateFormat = time.RFC3339
 
@@ -29,12 +70,26 @@ type ALogger interface {
 	Printf(format string, v ...interface{})
 }
 
-// Logger 是一个中间件处理程序，它在请求进入时记录Request，在请求退出时记录Response
+// Logger 是一个中间件处理程序，它在请求进入时记录Request(需要开启LogStart)，在请求退出时记录Response
 type Logger struct {
 	// ALogger 实现了足够的log.logger接口，以便与其他实现兼容
 	ALogger
-	dateFormat string
-	template   *template.Template
+	// Redaction 是传给模板的请求使用的脱敏策略，nil表示使用默认策略
+	Redaction *RedactionPolicy
+	// Formatter 决定日志的输出格式，SetFormat会把它设置为模板模式，
+	// 也可以设置为JSONLogFormatter或LogfmtLogFormatter
+	Formatter LogFormatter
+	// Fields 是每一行日志中额外输出的字段，值从请求header或context中读取
+	Fields []LogField
+	// Filter 不为nil时只记录它允许的请求
+	Filter *LogFilter
+	// LogStart 为true时在请求进入时输出一行Phase为LogPhaseStart的日志，设置了Filter时同样会被过滤
+	LogStart bool
+	// SlowThreshold 大于0时，请求处理超过这个时间还没有结束会输出一行
+	// Phase为LogPhaseRunning的警告，最终的日志也会被标记为Slow
+	SlowThreshold time.Duration
+	dateFormat    string
+	formatErrors  uint64
 }
 
 // NewLogger 返回一个新的Logger实例
@@ -44,27 +99,165 @@ func NewLogger() *Logger {
 	return logger
 }
 
-// SetFormat 设置模板格式
-func (l *Logger) SetFormat(format string) {
-	l.template = template.Must(template.New("negroni_parser").Parse(format))
+// SetFormat 设置模板格式，同时把Logger切换到模板模式
+// 模板中可以使用LoggerFuncMap中的函数，格式不合法时返回错误并保留原来的格式
+func (l *Logger) SetFormat(format string) error {
+	tpl, err := ParseLogFormat(format)
+	if err != nil {
+		return err
+	}
+	l.Formatter = &TemplateLogFormatter{Template: tpl}
+	return nil
 }
 
 // ServeHTTP
 func (l *Logger) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	start := time.Now()
+	rw, r, reqBody, resBody := l.captureBodies(rw, r)
+	// Logger排在RequestID之前时，由RequestID把请求ID写入recordedID
+	var recordedID string
+	if RequestIDFromRequest(r) == "" {
+		r = r.WithContext(withRequestIDRecorder(r.Context(), &recordedID))
+	}
+	// snapshot 是请求进入时脱敏后的快照，handler之后对请求的修改不会影响它
+	snapshot := l.newEntry(r, start)
+	// sample 在请求开始时抽取，开始和结束日志使用同一个采样结果
+	var sample float64
+	if l.Filter != nil && l.Filter.sampling() {
+		sample = l.Filter.draw()
+	}
+	if l.LogStart && (l.Filter == nil || l.Filter.allowStart(snapshot, sample)) {
+		entry := *snapshot
+		entry.Phase = LogPhaseStart
+		l.writeEntry(&entry)
+	}
+
+	// 看门狗和handler并发运行，只能读取快照，不能读取请求或response
+	var watchdog *time.Timer
+	if l.SlowThreshold > 0 {
+		watchdog = time.AfterFunc(l.SlowThreshold, func() {
+			entry := *snapshot
+			entry.Phase = LogPhaseRunning
+			entry.Duration = time.Since(start)
+			entry.Slow = true
+			l.writeEntry(&entry)
+		})
+	}
+
 	next(rw, r)
+	if watchdog != nil {
+		watchdog.Stop()
+	}
+
 	res := rw.(ResponseWriter)
-	log := LoggerEntry{
+	log := l.newEntry(r, start)
+	log.Status = res.Status()
+	log.Duration = time.Since(start)
+	log.Size = res.Size()
+	if log.RequestID == "" {
+		log.RequestID = recordedID
+	}
+	log.Slow = l.SlowThreshold > 0 && log.Duration >= l.SlowThreshold
+	if reqBody != nil {
+		log.RequestBody = []byte(l.Redaction.RedactString(reqBody.buff.String()))
+	}
+	if resBody != nil {
+		log.ResponseBody = []byte(l.Redaction.RedactString(resBody.buff.String()))
+	}
+
+	if l.Filter != nil {
+		if stats, elapsed, ok := l.Filter.report(time.Now()); ok {
+			if l.Filter.OnReport != nil {
+				l.Filter.OnReport(stats, elapsed)
+			}
+			l.writeEntry(l.reportEntry(stats, elapsed))
+		}
+		if !l.Filter.allow(log, func() float64 { return sample }) {
+			return
+		}
+	}
+	l.writeEntry(log)
+}
+
+// newEntry 返回只包含请求信息的LoggerEntry
+func (l *Logger) newEntry(r *http.Request, start time.Time) *LoggerEntry {
+	req := l.Redaction.RedactRequest(r)
+	user, _, _ := r.BasicAuth()
+	return &LoggerEntry{
+		Start:      start,
+		StartTime:  start.Format(l.dateFormat),
+		HostName:   r.Host,
+		Method:     r.Method,
+		Path:       l.Redaction.RedactString(r.URL.Path),
+		RemoteAddr: remoteIP(r.RemoteAddr),
+		User:       user,
+		Referer:    l.Redaction.RedactString(r.Referer()),
+		UserAgent:  r.UserAgent(),
+		Proto:      r.Proto,
+		RequestID:  RequestIDFromRequest(r),
+		Request:    req,
+		Fields:     l.fieldValues(req),
+	}
+}
+
+// reportEntry 返回LogFilter过滤统计的日志
+func (l *Logger) reportEntry(stats LogFilterStats, elapsed time.Duration) *LoggerEntry {
+	start := time.Now()
+	return &LoggerEntry{
+		Start:     start,
 		StartTime: start.Format(l.dateFormat),
-		Status:    res.Status(),
-		Duration:  time.Since(start),
-		HostName:  r.Host,
-		Method:    r.Method,
-		Path:      r.URL.Path,
-		Request:   r,
+		Duration:  elapsed,
+		Phase:     LogPhaseReport,
+		Fields: []LogFieldValue{
+			{LogFieldSuppressed, stats.Total()},
+			{LogFieldExcluded, stats.Excluded},
+			{LogFieldSampled, stats.Sampled},
+		},
+	}
+}
+
+// FormatErrors 返回因为格式化失败而没有输出的日志条数。
+// 错误不会写入日志流，避免破坏JSON、logfmt或CLF的格式
+func (l *Logger) FormatErrors() uint64 {
+	return atomic.LoadUint64(&l.formatErrors)
+}
+
+// writeEntry 格式化并输出一条日志，格式化结果为空时不输出
+func (l *Logger) writeEntry(entry *LoggerEntry) {
+	line, err := l.Formatter.FormatLog(entry)
+	if err != nil {
+		atomic.AddUint64(&l.formatErrors, 1)
+		return
+	}
+	if line != "" {
+		l.Println(line)
 	}
+}
 
-	buff := &bytes.Buffer{}
-	l.template.Execute(buff, log)
-	l.Println(buff.String())
+// remoteIP 去掉RemoteAddr中的端口
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// fieldValues 从已脱敏的请求中读取额外字段的值，读不到的字段值为nil
+func (l *Logger) fieldValues(r *http.Request) []LogFieldValue {
+	if len(l.Fields) == 0 {
+		return nil
+	}
+	values := make([]LogFieldValue, 0, len(l.Fields))
+	for _, field := range l.Fields {
+		var value interface{}
+		if field.Header != "" {
+			if v := r.Header.Get(field.Header); v != "" {
+				value = v
+			}
+		} else if field.ContextKey != nil {
+			value = r.Context().Value(field.ContextKey)
+		}
+		values = append(values, LogFieldValue{Name: field.Name, Value: value})
+	}
+	return values
 }
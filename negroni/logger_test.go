@@ -5,8 +5,10 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func Test_Logger(t *testing.T) {
@@ -78,3 +80,101 @@ func Test_LoggerCustomFormat(t *testing.T) {
 	n.ServeHTTP(recorder, req)
 	expect(t, strings.TrimSpace(buff.String()), "[negroni] bar "+userAgent+" - 200")
 }
+
+func Test_LoggerStartEntry(t *testing.T) {
+	var buff bytes.Buffer
+	l := NewLogger()
+	l.ALogger = log.New(&buff, "", 0)
+	l.SetFormat("{{.Phase}} {{.Method}} {{.Path}} {{.Status}}")
+	l.LogStart = true
+
+	n := New(l)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusCreated)
+	}))
+	n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/orders", nil))
+	expect(t, buff.String(), "start POST /orders 0\n POST /orders 201\n")
+}
+
+func Test_LoggerSlowRequestWatchdog(t *testing.T) {
+	var buff syncBuffer
+	l := NewLogger()
+	l.ALogger = log.New(&buff, "", 0)
+	l.Formatter = &LogfmtLogFormatter{}
+	l.SlowThreshold = 20 * time.Millisecond
+
+	release := make(chan struct{})
+	n := New(l)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		<-release
+		rw.WriteHeader(http.StatusOK)
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hang", nil))
+		close(done)
+	}()
+
+	// 等待看门狗输出警告，这时请求还没有结束
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(buff.String(), "phase=running") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	warning := buff.String()
+	expect(t, strings.Contains(warning, "path=/hang"), true)
+	expect(t, strings.Contains(warning, "status=0"), true)
+	expect(t, strings.Contains(warning, "slow=true"), true)
+
+	close(release)
+	<-done
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	expect(t, len(lines), 2)
+	expect(t, strings.Contains(lines[1], "status=200"), true)
+	expect(t, strings.Contains(lines[1], "phase="), false)
+	expect(t, strings.HasSuffix(lines[1], "slow=true"), true)
+}
+
+func Test_LoggerSlowRequestWatchdogUsesSnapshot(t *testing.T) {
+	var buff syncBuffer
+	l := NewLogger()
+	l.ALogger = log.New(&buff, "", 0)
+	l.Formatter = &LogfmtLogFormatter{}
+	l.SlowThreshold = time.Millisecond
+
+	n := New(l)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// handler在看门狗运行时修改请求
+		deadline := time.Now().Add(50 * time.Millisecond)
+		for i := 0; time.Now().Before(deadline); i++ {
+			r.Header.Set("X-Attempt", strconv.Itoa(i))
+			r.URL.Path = "/rewritten"
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+	n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hang", nil))
+
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	expect(t, len(lines), 2)
+	expect(t, strings.Contains(lines[0], "phase=running"), true)
+	expect(t, strings.Contains(lines[0], "path=/hang"), true)
+}
+
+func Test_LoggerFastRequestNotSlow(t *testing.T) {
+	var buff bytes.Buffer
+	l := NewLogger()
+	l.ALogger = log.New(&buff, "", 0)
+	l.Formatter = &CommonLogFormatter{}
+	l.SlowThreshold = time.Minute
+	l.LogStart = true
+
+	n := New(l)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	}))
+	n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fast", nil))
+
+	// Common Log Format不输出开始日志
+	expect(t, strings.Count(buff.String(), "\n"), 1)
+	expect(t, strings.Contains(buff.String(), `"GET /fast HTTP/1.1" 200 -`), true)
+}
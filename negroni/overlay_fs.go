@@ -0,0 +1,159 @@
+package negroni
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultWhiteoutPrefix 是NewOverlayFS使用的whiteout标记前缀
+const DefaultWhiteoutPrefix = ".wh."
+
+// OverlayFS 把多个http.FileSystem叠加成一个，排在前面的层覆盖后面的层。
+// 文件从第一个包含它的层中读取，目录的内容是所有层的合集
+type OverlayFS struct {
+	// Layers 是从上到下排列的各层
+	Layers []http.FileSystem
+	// WhiteoutPrefix 不为空时，上层中名为 前缀+文件名 的文件会隐藏下层中的同名文件或目录，
+	// 例如上层的 css/.wh.old.css 隐藏下层的 css/old.css。标记文件本身不会被返回
+	WhiteoutPrefix string
+}
+
+// NewOverlayFS 返回由layers组成的文件系统，layers从上到下排列
+func NewOverlayFS(layers ...http.FileSystem) *OverlayFS {
+	return &OverlayFS{Layers: layers, WhiteoutPrefix: DefaultWhiteoutPrefix}
+}
+
+// Open 实现http.FileSystem
+func (fs *OverlayFS) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	if fs.isWhiteout(path.Base(name)) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	var dirs []http.File
+	for _, layer := range fs.Layers {
+		if f, err := layer.Open(name); err == nil {
+			fi, err := f.Stat()
+			switch {
+			case err != nil:
+				f.Close()
+			case fi.IsDir():
+				dirs = append(dirs, f)
+			case len(dirs) == 0:
+				return f, nil
+			default:
+				// 上层已经有同名目录时，下层的文件被目录遮住
+				f.Close()
+			}
+		}
+		// 这一层的标记隐藏所有更下面的层
+		if fs.whitedOut(layer, name) {
+			break
+		}
+	}
+
+	switch len(dirs) {
+	case 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case 1:
+		if fs.WhiteoutPrefix == "" {
+			return dirs[0], nil
+		}
+	}
+	return &overlayDir{File: dirs[0], layers: dirs, fs: fs}, nil
+}
+
+// isWhiteout 返回name是否是whiteout标记
+func (fs *OverlayFS) isWhiteout(name string) bool {
+	return fs.WhiteoutPrefix != "" && strings.HasPrefix(name, fs.WhiteoutPrefix)
+}
+
+// whitedOut 返回layer中是否有标记隐藏了下层中的name或它的某个上级目录
+func (fs *OverlayFS) whitedOut(layer http.FileSystem, name string) bool {
+	if fs.WhiteoutPrefix == "" {
+		return false
+	}
+	for p := name; p != "/"; p = path.Dir(p) {
+		f, err := layer.Open(path.Join(path.Dir(p), fs.WhiteoutPrefix+path.Base(p)))
+		if err == nil {
+			f.Close()
+			return true
+		}
+	}
+	return false
+}
+
+// overlayDir 是合并了多个层的目录，Stat返回最上层目录的信息
+type overlayDir struct {
+	http.File
+	layers  []http.File
+	fs      *OverlayFS
+	entries []os.FileInfo
+	read    bool
+	offset  int
+}
+
+func (d *overlayDir) Close() error {
+	var err error
+	for _, f := range d.layers {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Readdir 与os.File.Readdir的语义相同，同名条目取最上层的
+func (d *overlayDir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.read {
+		if err := d.merge(); err != nil {
+			return nil, err
+		}
+		d.read = true
+	}
+	rest := d.entries[d.offset:]
+	if count > 0 {
+		if len(rest) == 0 {
+			return nil, io.EOF
+		}
+		if count < len(rest) {
+			rest = rest[:count]
+		}
+	}
+	d.offset += len(rest)
+	return rest, nil
+}
+
+// merge 读取所有层的条目，上层的whiteout标记隐藏下层的同名条目
+func (d *overlayDir) merge() error {
+	seen := make(map[string]bool)
+	for _, f := range d.layers {
+		infos, err := f.Readdir(-1)
+		if err != nil {
+			return err
+		}
+		var hidden []string
+		for _, fi := range infos {
+			name := fi.Name()
+			if d.fs.isWhiteout(name) {
+				hidden = append(hidden, strings.TrimPrefix(name, d.fs.WhiteoutPrefix))
+				continue
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			d.entries = append(d.entries, fi)
+		}
+		// 标记只影响更下面的层
+		for _, name := range hidden {
+			seen[name] = true
+		}
+	}
+	sort.Slice(d.entries, func(i, j int) bool { return d.entries[i].Name() < d.entries[j].Name() })
+	return nil
+}
@@ -0,0 +1,120 @@
+package negroni
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestOverlay(t *testing.T) (*OverlayFS, func()) {
+	theme := newStaticDir(t, map[string]string{
+		"css/app.css":     "theme",
+		"css/.wh.old.css": "",
+		".wh.legacy":      "",
+		"theme.txt":       "theme only",
+	})
+	defaults := newStaticDir(t, map[string]string{
+		"index.html":   "<h1>default</h1>",
+		"css/app.css":  "default",
+		"css/base.css": "base",
+		"css/old.css":  "old",
+		"legacy/a.js":  "legacy",
+		"theme.txt/x":  "shadowed by file",
+	})
+	fs := NewOverlayFS(http.Dir(theme), http.Dir(defaults))
+	return fs, func() {
+		os.RemoveAll(theme)
+		os.RemoveAll(defaults)
+	}
+}
+
+func readOverlay(t *testing.T, fs http.FileSystem, name string) (string, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	return string(data), err
+}
+
+func TestOverlayFSResolve(t *testing.T) {
+	fs, cleanup := newTestOverlay(t)
+	defer cleanup()
+
+	content, _ := readOverlay(t, fs, "/css/app.css")
+	expect(t, content, "theme")
+	content, _ = readOverlay(t, fs, "/css/base.css")
+	expect(t, content, "base")
+	content, _ = readOverlay(t, fs, "/index.html")
+	expect(t, content, "<h1>default</h1>")
+	content, _ = readOverlay(t, fs, "/theme.txt")
+	expect(t, content, "theme only")
+
+	for _, name := range []string{"/css/old.css", "/legacy/a.js", "/legacy", "/css/.wh.old.css", "/missing"} {
+		if _, err := fs.Open(name); !os.IsNotExist(err) {
+			t.Errorf("expected %s to not exist, got %v", name, err)
+		}
+	}
+}
+
+func TestOverlayFSReaddir(t *testing.T) {
+	fs, cleanup := newTestOverlay(t)
+	defer cleanup()
+
+	names := func(dir string) string {
+		f, err := fs.Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		infos, err := f.Readdir(-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var list []string
+		for _, fi := range infos {
+			list = append(list, fi.Name())
+		}
+		return strings.Join(list, ",")
+	}
+	expect(t, names("/"), "css,index.html,theme.txt")
+	expect(t, names("/css"), "app.css,base.css")
+
+	f, _ := fs.Open("/css")
+	infos, err := f.Readdir(1)
+	expect(t, err, nil)
+	expect(t, infos[0].Name(), "app.css")
+	infos, _ = f.Readdir(5)
+	expect(t, len(infos), 1)
+	fi, _ := f.Stat()
+	expect(t, fi.IsDir(), true)
+
+	// 没有whiteout时也合并目录
+	fs.WhiteoutPrefix = ""
+	expect(t, names("/css"), ".wh.old.css,app.css,base.css,old.css")
+}
+
+func TestStaticOverlayFS(t *testing.T) {
+	fs, cleanup := newTestOverlay(t)
+	defer cleanup()
+	s := NewStatic(fs)
+	s.Browse = true
+
+	recorder := serveStatic(s, httptest.NewRequest("GET", "/", nil))
+	expect(t, recorder.Body.String(), "<h1>default</h1>")
+
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/css/app.css", nil))
+	expect(t, recorder.Body.String(), "theme")
+
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/css/old.css", nil))
+	expect(t, recorder.Code, http.StatusTeapot)
+
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/css/", nil))
+	body := recorder.Body.String()
+	expect(t, strings.Contains(body, "base.css"), true)
+	expect(t, strings.Contains(body, "old.css"), false)
+}
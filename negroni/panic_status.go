@@ -0,0 +1,112 @@
+package negroni
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// PanicError 是一个可以直接作为panic值使用的错误，它自带HTTP状态码和公开信息
+// Recovery 恢复到PanicError(或者包装了PanicError的错误)时会直接使用其中的状态码和信息
+type PanicError struct {
+	// Status 是返回给客户端的HTTP状态码
+	Status int
+	// Message 是返回给客户端的公开信息，为空时使用状态码对应的默认文本
+	Message string
+	// Err 是引起panic的原始错误，不会返回给客户端
+	Err error
+}
+
+func (e *PanicError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%d %s: %v", e.Status, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%d %s", e.Status, e.Message)
+}
+
+// Unwrap 返回原始错误
+func (e *PanicError) Unwrap() error {
+	return e.Err
+}
+
+// panicMapping 是panic值到HTTP状态码的一条映射规则
+type panicMapping struct {
+	match   func(v interface{}) bool
+	status  int
+	message string
+}
+
+// validStatus 返回status是否是WriteHeader接受的状态码
+func validStatus(status int) bool {
+	return status >= 100 && status <= 599
+}
+
+// checkMappedStatus 在注册映射时检查状态码，无效的状态码会让Recovery在恢复时再次panic
+func checkMappedStatus(status int) {
+	if !validStatus(status) {
+		panic(fmt.Sprintf("invalid status code %d", status))
+	}
+}
+
+// MapError 把和target匹配(errors.Is)的panic错误映射为给定的状态码和公开信息，
+// status不在100到599之间时panic
+// 例如 rec.MapError(context.DeadlineExceeded, http.StatusGatewayTimeout, "")
+func (rec *Recovery) MapError(target error, status int, message string) {
+	checkMappedStatus(status)
+	rec.mappings = append(rec.mappings, panicMapping{
+		match: func(v interface{}) bool {
+			err, ok := v.(error)
+			return ok && errors.Is(err, target)
+		},
+		status:  status,
+		message: message,
+	})
+}
+
+// MapType 把和sample类型相同的panic值映射为给定的状态码和公开信息
+// 如果sample是error类型，被包装过的错误也会通过errors.As匹配，status不在100到599之间时panic
+// 例如 rec.MapType(&ValidationError{}, http.StatusBadRequest, "invalid request")
+func (rec *Recovery) MapType(sample interface{}, status int, message string) {
+	typ := reflect.TypeOf(sample)
+	if typ == nil {
+		panic("sample cannot be nil")
+	}
+	checkMappedStatus(status)
+	isError := typ.Implements(reflect.TypeOf((*error)(nil)).Elem())
+	rec.mappings = append(rec.mappings, panicMapping{
+		match: func(v interface{}) bool {
+			if reflect.TypeOf(v) == typ {
+				return true
+			}
+			err, ok := v.(error)
+			return ok && isError && errors.As(err, reflect.New(typ).Interface())
+		},
+		status:  status,
+		message: message,
+	})
+}
+
+// resolveStatus 返回panic值对应的状态码和公开信息
+// 先检查PanicError(状态码无效时忽略)，再按添加顺序检查映射规则，都不匹配时返回500
+func (rec *Recovery) resolveStatus(v interface{}) (int, string) {
+	if err, ok := v.(error); ok {
+		var pe *PanicError
+		if errors.As(err, &pe) && validStatus(pe.Status) {
+			return pe.Status, publicMessage(pe.Status, pe.Message)
+		}
+	}
+	for _, m := range rec.mappings {
+		if m.match(v) {
+			return m.status, publicMessage(m.status, m.message)
+		}
+	}
+	return http.StatusInternalServerError, NoPrintStackBodyString
+}
+
+func publicMessage(status int, message string) string {
+	if message != "" {
+		return message
+	}
+	return fmt.Sprintf("%d %s", status, http.StatusText(status))
+}
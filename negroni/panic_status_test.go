@@ -0,0 +1,122 @@
+package negroni
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type validationError struct {
+	Field string
+}
+
+func (e *validationError) Error() string {
+	return "invalid " + e.Field
+}
+
+type recordingFormatter struct {
+	infos *PanicInformation
+}
+
+func (f *recordingFormatter) FormatPanicError(rw http.ResponseWriter, r *http.Request, infos *PanicInformation) {
+	f.infos = infos
+	fmt.Fprint(rw, infos.Message)
+}
+
+func serveMappedPanic(rec *Recovery, value interface{}) *httptest.ResponseRecorder {
+	rec.Logger = log.New(&bytes.Buffer{}, "", 0)
+	n := New()
+	n.Use(rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic(value)
+	}))
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	n.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestRecoveryMapType(t *testing.T) {
+	rec := NewRecovery()
+	rec.PrintStack = false
+	rec.MapType(&validationError{}, http.StatusBadRequest, "invalid request")
+
+	recorder := serveMappedPanic(rec, &validationError{Field: "name"})
+	expect(t, recorder.Code, http.StatusBadRequest)
+	expect(t, recorder.Body.String(), "invalid request")
+
+	wrapped := fmt.Errorf("decode: %w", &validationError{Field: "age"})
+	recorder = serveMappedPanic(rec, wrapped)
+	expect(t, recorder.Code, http.StatusBadRequest)
+}
+
+func TestRecoveryMapError(t *testing.T) {
+	rec := NewRecovery()
+	rec.PrintStack = false
+	rec.MapError(context.DeadlineExceeded, http.StatusGatewayTimeout, "")
+
+	recorder := serveMappedPanic(rec, fmt.Errorf("query: %w", context.DeadlineExceeded))
+	expect(t, recorder.Code, http.StatusGatewayTimeout)
+	expect(t, recorder.Body.String(), "504 Gateway Timeout")
+}
+
+func TestRecoveryPanicError(t *testing.T) {
+	rec := NewRecovery()
+	rec.PrintStack = false
+
+	recorder := serveMappedPanic(rec, &PanicError{Status: http.StatusConflict, Message: "already exists"})
+	expect(t, recorder.Code, http.StatusConflict)
+	expect(t, recorder.Body.String(), "already exists")
+}
+
+func TestRecoveryMapInvalidStatus(t *testing.T) {
+	rec := NewRecovery()
+	for _, status := range []int{0, 99, 600, 1000} {
+		for _, register := range []func(){
+			func() { rec.MapError(context.Canceled, status, "") },
+			func() { rec.MapType(&validationError{}, status, "") },
+		} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("expected status %d to be rejected", status)
+					}
+				}()
+				register()
+			}()
+		}
+	}
+	expect(t, len(rec.mappings), 0)
+
+	// PanicError中无效的状态码按500处理
+	rec.PrintStack = false
+	recorder := serveMappedPanic(rec, &PanicError{Status: 1000, Message: "bad"})
+	expect(t, recorder.Code, http.StatusInternalServerError)
+}
+
+func TestRecoveryUnmappedPanic(t *testing.T) {
+	rec := NewRecovery()
+	rec.PrintStack = false
+	rec.MapType(&validationError{}, http.StatusBadRequest, "invalid request")
+
+	recorder := serveMappedPanic(rec, "something else")
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	expect(t, recorder.Body.String(), NoPrintStackBodyString)
+}
+
+func TestRecoveryFormatterReceivesStatus(t *testing.T) {
+	formatter := &recordingFormatter{}
+	rec := NewRecovery()
+	rec.Formatter = formatter
+	rec.MapError(context.Canceled, 499, "client closed request")
+
+	recorder := serveMappedPanic(rec, context.Canceled)
+	expect(t, recorder.Code, 499)
+	expect(t, formatter.infos.Status, 499)
+	expect(t, formatter.infos.Message, "client closed request")
+	expect(t, recorder.Body.String(), "client closed request")
+}
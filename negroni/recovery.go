@@ -2,12 +2,15 @@ package negroni
 
 import (
 	"fmt"
+	"html/template"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"runtime"
 	"runtime/debug"
-	"text/template"
+	"strconv"
+	"time"
 )
 
 const (
@@ -16,7 +19,7 @@ const (
 	panicText              = "PANIC: %s\n%s"
 	nilRequestMessage      = "Request is nil"
 	panicHTML              = `<html>
-<head><title>PANIC: {{.RecoveredPanic}}</title></head>
+<head><title>PANIC: {{.PanicDescription}}</title></head>
 <style type="text/css">
 html, body {
 	font-family: Helvetica, Arial, Sans;
@@ -44,16 +47,59 @@ h1 {
 .panic-interface-title {
 	font-weight: bold;
 }
+.goroutine h4 {
+	margin-bottom: 0.5em;
+}
+.frame {
+	padding: 0.3em 0;
+	border-bottom: solid 1px #eaecef;
+}
+.frame summary {
+	cursor: pointer;
+}
+.frame-stdlib {
+	color: #999999;
+}
+.frame-location {
+	font-family: monospace;
+	color: #6a737d;
+}
+.frame-source {
+	padding: 0.5em 1em;
+	background: #f6f8fa;
+}
+.frame-source .current {
+	background: #ffdce0;
+	font-weight: bold;
+}
 </style>
 <body>
 <h1>Negroni - PANIC</h1>
 
 <div class="panic-interface block">
 	<h3>{{.RequestDescription}}</h3>
-	<span class="panic-interface-title">Runtime error:</span> <span class="panic-interface-element">{{.RecoveredPanic}}</span>
+	{{ if .RequestID }}<span class="panic-interface-title">Request ID:</span> <span class="panic-interface-element">{{.RequestID}}</span><br>{{ end }}
+	<span class="panic-interface-title">Runtime error:</span> <span class="panic-interface-element">{{.PanicDescription}}</span><br>
+	<span class="panic-interface-title">Response:</span> <span class="panic-interface-element">{{.Message}}</span>
 </div>
 
-{{ if .Stack }}
+{{ if .Goroutines }}
+<div class="panic-stack block">
+	<h3>Runtime Stack</h3>
+	{{ range .Goroutines }}
+	<div class="goroutine">
+		<h4>goroutine {{.ID}} [{{.State}}]</h4>
+		{{ range .Frames }}
+		<details class="frame{{ if .Stdlib }} frame-stdlib{{ end }}"{{ if not .Stdlib }} open{{ end }}>
+			<summary><span class="frame-function">{{ if .CreatedBy }}created by {{ end }}{{.Function}}</span> <span class="frame-location">{{.File}}:{{.Line}}</span></summary>
+			{{ if .Source }}<pre class="frame-source">{{ range .Source }}<span{{ if .Current }} class="current"{{ end }}>{{printf "%5d" .Number}}  {{.Code}}</span>
+{{ end }}</pre>{{ end }}
+		</details>
+		{{ end }}
+	</div>
+	{{ end }}
+</div>
+{{ else if .Stack }}
 <div class="panic-stack-raw block">
 	<h3>Runtime Stack</h3>
 	<pre>{{.StackAsString}}</pre>
@@ -71,6 +117,25 @@ type PanicInformation struct {
 	RecoveredPanic interface{}
 	Stack          []byte
 	Request        *http.Request
+	// Status 是根据panic值解析出的HTTP状态码
+	Status int
+	// Message 是可以返回给客户端的公开信息
+	Message string
+	// Redaction 是输出请求和panic信息时使用的脱敏策略，nil表示使用默认策略
+	Redaction *RedactionPolicy
+	// RequestID 是RequestID中间件设置的请求ID
+	RequestID string
+	// Spawned 表示panic发生在通过Go启动的goroutine中，这时不会有response写入
+	Spawned bool
+}
+
+// Goroutines 返回解析后的堆栈，包含每个goroutine的调用帧
+// 如果没有堆栈信息则返回nil
+func (p *PanicInformation) Goroutines() []Goroutine {
+	if len(p.Stack) == 0 {
+		return nil
+	}
+	return ParseStack(p.Stack)
 }
 
 // StackAsString 返回堆栈的可打印版本
@@ -78,17 +143,17 @@ func (p *PanicInformation) StackAsString() string {
 	return string(p.Stack)
 }
 
-// RequestDescription 返回一个可打印的url
+// RequestDescription 返回一个可打印的url，敏感的query参数会被隐藏
 func (p *PanicInformation) RequestDescription() string {
 	if p.Request == nil {
 		return nilRequestMessage
 	}
+	return fmt.Sprintf("%s %s", p.Request.Method, p.Redaction.RedactURL(p.Request.URL))
+}
 
-	var queryOutput string
-	if p.Request.URL.RawQuery != "" {
-		queryOutput = "?" + p.Request.URL.RawQuery
-	}
-	return fmt.Sprint("%s %s%s", p.Request.Method, p.Request.URL.Path, queryOutput)
+// PanicDescription 返回隐藏了敏感信息的panic值的文本形式
+func (p *PanicInformation) PanicDescription() string {
+	return p.Redaction.RedactValue(p.RecoveredPanic)
 }
 
 // PanicFormatter 是对象上的接口，可以实现用来输出堆栈的跟踪信息
@@ -96,6 +161,7 @@ type PanicFormatter interface {
 	// FormatPanicError 为给定的应答/响应输出堆栈
 	// 如果中间件不输出堆栈跟踪信息
 	// 那么传递的PanicInformation 的Stack 为空的字节数组[]btye{}
+	// 调用时状态码infos.Status已经写入了rw
 	FormatPanicError(rw http.ResponseWriter, r *http.Request, infos *PanicInformation)
 }
 
@@ -109,23 +175,54 @@ func (t *TextPanicFormatter) FormatPanicError(rw http.ResponseWriter, r *http.Re
 	if rw.Header().Get("Content-type") == "" {
 		rw.Header().Set("Content-type", "text/plain; charset=utf-8")
 	}
-	fmt.Fprintf(rw, panicText, infos.RecoveredPanic, infos.Stack)
+	if infos.RequestID != "" {
+		fmt.Fprintf(rw, "Request ID: %s\n", infos.RequestID)
+	}
+	fmt.Fprintf(rw, panicText, infos.PanicDescription(), infos.Stack)
 }
 
 // HTMLPanicFormatter 输出堆栈信息到HTML页面内。
 // 这在很大程度上受到了
 // https://github.com/go-martini/martini/pull/156/commits的启发。
-type HTMLPanicFormatter struct{}
+type HTMLPanicFormatter struct {
+	// Development 为true时每一帧都会显示附近的源代码，只应在开发环境中开启
+	Development bool
+	// SourceLines 是开发模式下调用点前后显示的源代码行数，为0时使用默认值
+	SourceLines int
+}
+
+// DefaultSourceLines 是开发模式下调用点前后默认显示的源代码行数
+const DefaultSourceLines = 3
+
+// panicPage 是传递给panicHTMLTemplate的数据
+type panicPage struct {
+	*PanicInformation
+	Goroutines []Goroutine
+}
 
 // FormatPanicError 实现PanicFormatter接口方法
 func (t *HTMLPanicFormatter) FormatPanicError(rw http.ResponseWriter, r *http.Request, infos *PanicInformation) {
 	if rw.Header().Get("Content-Type") == "" {
 		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
 	}
-	panicHTMLTemplate.Execute(rw, infos)
+	page := &panicPage{PanicInformation: infos, Goroutines: infos.Goroutines()}
+	if t.Development {
+		lines := t.SourceLines
+		if lines <= 0 {
+			lines = DefaultSourceLines
+		}
+		for i := range page.Goroutines {
+			frames := page.Goroutines[i].Frames
+			for j := range frames {
+				frames[j].Source = readSourceLines(frames[j].File, frames[j].Line, lines)
+			}
+		}
+	}
+	panicHTMLTemplate.Execute(rw, page)
 }
 
 // Recovery 是一个可以让程序从任何panic崩溃中恢复的中间件，如果发生panic还会写入一个500错误
+// 通过MapError和MapType可以把特定的panic值映射为其他状态码
 type Recovery struct {
 	Logger           ALogger
 	PrintStack       bool
@@ -138,6 +235,17 @@ type Recovery struct {
 	// Deprecated: 请改用PanicHandlerFunc
 	// 接收包含附加信息的panic错误(请参阅PanicInformation)
 	ErrorHandleFunc func(interface{})
+
+	// CrashReporter 不为nil时每次panic都会保存一份crash报告
+	CrashReporter CrashReporter
+
+	// Breaker 不为nil时，频繁panic的路由会被暂时熔断并直接返回503
+	Breaker *PanicBreaker
+
+	// Redaction 是日志、panic页面和crash报告使用的脱敏策略，nil表示使用默认策略
+	Redaction *RedactionPolicy
+
+	mappings []panicMapping
 }
 
 // NewRecovery 返回一个新的Recovery实例
@@ -156,51 +264,118 @@ func NewRecovery() *Recovery {
 func (rec *Recovery) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	defer func() {
 		if err := recover(); err != nil {
-			rw.WriteHeader(http.StatusInternalServerError)
+			// http.ErrAbortHandler 是handler主动中断连接的信号，
+			// 交还给net/http处理，它会静默地关闭连接
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
 			stack := make([]byte, rec.StackSize)
 			//他认为他给的Size足够大，才这么操作的
 			stack = stack[:runtime.Stack(stack, rec.StackAll)]
-			infos := &PanicInformation{RecoveredPanic: err, Request: r}
-
-			if rec.PrintStack {
-				infos.Stack = stack
-				rec.Formatter.FormatPanicError(rw, r, infos)
-			} else {
-				if rw.Header().Get("Content-Type") == "" {
-					rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
-				}
-				fmt.Fprint(rw, NoPrintStackBodyString)
+			infos := &PanicInformation{
+				RecoveredPanic: err,
+				Request:        r,
+				Redaction:      rec.Redaction,
+				RequestID:      RequestIDFromRequest(r),
 			}
+			infos.Status, infos.Message = rec.resolveStatus(err)
 
-			if rec.LogStack {
-				rec.Logger.Printf(panicText, err, stack)
+			// 如果response已经开始写入，再写入500和错误信息只会在已发送的内容后面追加垃圾数据，
+			// 这时只记录panic，然后中断连接让客户端知道response不完整
+			started := responseStarted(rw)
+			if !started {
+				rw.WriteHeader(infos.Status)
+				if rec.PrintStack {
+					infos.Stack = stack
+					rec.Formatter.FormatPanicError(rw, r, infos)
+				} else {
+					if rw.Header().Get("Content-Type") == "" {
+						rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+					}
+					fmt.Fprint(rw, infos.Message)
+				}
 			}
 
-			if rec.ErrorHandleFunc != nil {
-				func() {
-					defer func() {
-						if err := recover(); err != nil {
-							rec.Logger.Printf("provided ErrorHandlerFunc panic'd: %s, trace:\n%s", err, debug.Stack())
-							rec.Logger.Printf("%s\n", debug.Stack())
-						}
-					}()
-					rec.ErrorHandleFunc(err)
-				}()
+			if rec.Breaker != nil {
+				rec.Breaker.RecordPanic(r)
 			}
+			rec.reportPanic(infos, stack)
 
-			if rec.PaincHandlerFunc != nil {
-				func() {
-					defer func() {
-						if err := recover(); err != nil {
-							rec.Logger.Printf("provided PanicHandlerFunc panic'd: %s, trace:\n%s", err, debug.Stack())
-							rec.Logger.Printf("%s\n", debug.Stack())
-						}
-					}()
-					rec.PaincHandlerFunc(infos)
-				}()
+			if started {
+				panic(http.ErrAbortHandler)
 			}
 		}
 	}()
 
-	next(rw, r)
+	if rec.Breaker != nil {
+		if open, wait := rec.Breaker.Open(r); open {
+			serveBreakerOpen(rw, wait)
+			return
+		}
+	}
+
+	next(rw, withRecovery(r, rec))
+}
+
+// serveBreakerOpen 返回503，并通过Retry-After告诉客户端多久后重试
+func serveBreakerOpen(rw http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	rw.Header().Set("Retry-After", strconv.Itoa(seconds))
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprint(rw, publicMessage(http.StatusServiceUnavailable, ""))
+}
+
+// responseStarted 返回response是否已经写入过
+// 只有negroni的ResponseWriter能知道这一点，其他实现都认为还未写入
+func responseStarted(rw http.ResponseWriter) bool {
+	nrw, ok := rw.(ResponseWriter)
+	return ok && nrw.Written()
+}
+
+// reportPanic 记录panic并调用用户提供的处理函数
+func (rec *Recovery) reportPanic(infos *PanicInformation, stack []byte) {
+	err := infos.RecoveredPanic
+	if rec.LogStack {
+		// 熔断期间同一指纹的堆栈只记录一次，避免刷屏
+		if rec.Breaker == nil || rec.Breaker.SampleStack(infos.Request, StackFingerprint(stack)) {
+			rec.Logger.Printf(panicText, infos.PanicDescription(), stack)
+		} else {
+			rec.Logger.Printf("PANIC: %s (stack suppressed, breaker open for %s)", infos.PanicDescription(), rec.Breaker.key(infos.Request))
+		}
+	}
+
+	if rec.CrashReporter != nil {
+		if err := rec.CrashReporter.ReportCrash(infos, stack); err != nil {
+			rec.Logger.Printf("failed to save crash report: %s", err)
+		}
+	}
+
+	if rec.ErrorHandleFunc != nil {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					rec.Logger.Printf("provided ErrorHandlerFunc panic'd: %s, trace:\n%s", err, debug.Stack())
+					rec.Logger.Printf("%s\n", debug.Stack())
+				}
+			}()
+			rec.ErrorHandleFunc(err)
+		}()
+	}
+
+	if rec.PaincHandlerFunc != nil {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					rec.Logger.Printf("provided PanicHandlerFunc panic'd: %s, trace:\n%s", err, debug.Stack())
+					rec.Logger.Printf("%s\n", debug.Stack())
+				}
+			}()
+			rec.PaincHandlerFunc(infos)
+		}()
+	}
 }
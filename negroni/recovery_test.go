@@ -1 +1,157 @@
 package negroni
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryHTMLFormatterFrames(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	rec := NewRecovery()
+	rec.Logger = log.New(&bytes.Buffer{}, "", 0)
+	rec.Formatter = &HTMLPanicFormatter{}
+
+	n := New()
+	n.Use(rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic("<script>boom</script>")
+	}))
+	req, _ := http.NewRequest("GET", "http://localhost:3000/foo?bar=baz", nil)
+	n.ServeHTTP(recorder, req)
+
+	body := recorder.Body.String()
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	expect(t, recorder.Header().Get("Content-Type"), "text/html; charset=utf-8")
+	expect(t, strings.Contains(body, "GET /foo?bar=baz"), true)
+	expect(t, strings.Contains(body, "<script>boom"), false)
+	expect(t, strings.Contains(body, "TestRecoveryHTMLFormatterFrames"), true)
+	expect(t, strings.Contains(body, `class="frame frame-stdlib"`), true)
+	expect(t, strings.Contains(body, `class="frame-source"`), false)
+}
+
+func TestRecoveryHTMLFormatterDevelopment(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	rec := NewRecovery()
+	rec.Logger = log.New(&bytes.Buffer{}, "", 0)
+	rec.Formatter = &HTMLPanicFormatter{Development: true, SourceLines: 1}
+
+	n := New()
+	n.Use(rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic("development panic")
+	}))
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	n.ServeHTTP(recorder, req)
+
+	body := recorder.Body.String()
+	expect(t, strings.Contains(body, `class="frame-source"`), true)
+	expect(t, strings.Contains(body, `panic(&#34;development panic&#34;)`), true)
+}
+
+func TestPanicInformationGoroutines(t *testing.T) {
+	infos := &PanicInformation{}
+	expect(t, len(infos.Goroutines()), 0)
+
+	infos.Stack = []byte(sampleStack)
+	expect(t, len(infos.Goroutines()), 2)
+}
+
+func TestRecoveryErrAbortHandler(t *testing.T) {
+	var buff bytes.Buffer
+	handlerCalled := false
+	rec := NewRecovery()
+	rec.Logger = log.New(&buff, "", 0)
+	rec.PaincHandlerFunc = func(*PanicInformation) { handlerCalled = true }
+
+	n := New()
+	n.Use(rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	defer func() {
+		expect(t, recover(), http.ErrAbortHandler)
+		expect(t, recorder.Body.Len(), 0)
+		expect(t, buff.Len(), 0)
+		expect(t, handlerCalled, false)
+	}()
+	n.ServeHTTP(recorder, req)
+	t.Error("expected ErrAbortHandler to be re-panicked")
+}
+
+func TestRecoveryResponseAlreadyStarted(t *testing.T) {
+	var buff bytes.Buffer
+	var infos *PanicInformation
+	rec := NewRecovery()
+	rec.Logger = log.New(&buff, "", 0)
+	rec.PaincHandlerFunc = func(i *PanicInformation) { infos = i }
+
+	n := New()
+	n.Use(rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("partial"))
+		panic("midway")
+	}))
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	defer func() {
+		expect(t, recover(), http.ErrAbortHandler)
+		expect(t, recorder.Code, http.StatusOK)
+		expect(t, recorder.Body.String(), "partial")
+		expect(t, strings.Contains(buff.String(), "PANIC: midway"), true)
+		refute(t, infos, (*PanicInformation)(nil))
+	}()
+	n.ServeHTTP(recorder, req)
+	t.Error("expected the connection to be aborted")
+}
+
+func TestRecoveryResponseNotStarted(t *testing.T) {
+	rec := NewRecovery()
+	rec.Logger = log.New(&bytes.Buffer{}, "", 0)
+	rec.PrintStack = false
+
+	n := New()
+	n.Use(rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("X-Partial", "true")
+		panic("before write")
+	}))
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	n.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	expect(t, recorder.Body.String(), NoPrintStackBodyString)
+}
+
+func TestRecoveryEndToEndAbort(t *testing.T) {
+	rec := NewRecovery()
+	rec.Logger = log.New(&bytes.Buffer{}, "", 0)
+
+	n := New()
+	n.Use(rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("partial"))
+		rw.(http.Flusher).Flush()
+		panic("midway")
+	}))
+	server := httptest.NewServer(n)
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	expect(t, res.StatusCode, http.StatusOK)
+	_, err = ioutil.ReadAll(res.Body)
+	refute(t, err, nil)
+}
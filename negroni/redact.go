@@ -0,0 +1,178 @@
+package negroni
+
+import (
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// DefaultRedactionMask 是替换敏感信息时默认使用的文本
+const DefaultRedactionMask = "[REDACTED]"
+
+// RedactionPolicy 描述在日志、panic页面和crash报告中需要隐藏的敏感信息。
+// Recovery、Logger和FileCrashReporter共用同一套规则，nil表示使用DefaultRedactionPolicy
+type RedactionPolicy struct {
+	// QueryParams 是需要隐藏值的query参数名，不区分大小写
+	QueryParams []string
+	// Headers 是需要隐藏值的header名，不区分大小写
+	Headers []string
+	// Patterns 匹配到的文本会被整体替换，用于panic信息和路径等自由文本
+	Patterns []*regexp.Regexp
+	// Mask 是替换用的文本，为空时使用DefaultRedactionMask
+	Mask string
+}
+
+// DefaultRedactionPolicy 返回一个隐藏常见凭证的策略
+func DefaultRedactionPolicy() *RedactionPolicy {
+	return &RedactionPolicy{
+		QueryParams: []string{"access_token", "api_key", "apikey", "password", "secret", "token"},
+		Headers:     []string{"Authorization", "Cookie", "Proxy-Authorization", "Set-Cookie", "X-Api-Key"},
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)bearer\s+[a-z0-9\-._~+/]+=*`),
+			regexp.MustCompile(`(?i)(access_token|api_key|apikey|password|secret|token)=[^&\s]+`),
+		},
+	}
+}
+
+// defaultRedactionPolicy 是策略为nil时使用的默认策略
+var defaultRedactionPolicy = DefaultRedactionPolicy()
+
+func (p *RedactionPolicy) orDefault() *RedactionPolicy {
+	if p == nil {
+		return defaultRedactionPolicy
+	}
+	return p
+}
+
+func (p *RedactionPolicy) mask() string {
+	if p.Mask == "" {
+		return DefaultRedactionMask
+	}
+	return p.Mask
+}
+
+// RedactString 把文本中匹配Patterns的部分替换掉
+func (p *RedactionPolicy) RedactString(s string) string {
+	p = p.orDefault()
+	for _, pattern := range p.Patterns {
+		s = pattern.ReplaceAllLiteralString(s, p.mask())
+	}
+	return s
+}
+
+// RedactQuery 隐藏原始query字符串中敏感参数的值，其他参数保持原样
+func (p *RedactionPolicy) RedactQuery(rawQuery string) string {
+	p = p.orDefault()
+	if rawQuery == "" {
+		return ""
+	}
+	pairs := strings.Split(rawQuery, "&")
+	for i, pair := range pairs {
+		key := pair
+		if j := strings.IndexAny(pair, "=;"); j >= 0 {
+			key = pair[:j]
+		}
+		if name, err := url.QueryUnescape(key); err == nil && containsFold(p.QueryParams, name) {
+			pairs[i] = key + "=" + p.mask()
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// RedactURL 返回隐藏了敏感信息的path和query
+func (p *RedactionPolicy) RedactURL(u *url.URL) string {
+	p = p.orDefault()
+	if u == nil {
+		return ""
+	}
+	s := p.RedactString(u.Path)
+	if u.RawQuery != "" {
+		s += "?" + p.RedactQuery(u.RawQuery)
+	}
+	return s
+}
+
+// RedactHeader 返回一个敏感header的值被隐藏的副本
+func (p *RedactionPolicy) RedactHeader(h http.Header) http.Header {
+	p = p.orDefault()
+	clone := h.Clone()
+	for name := range clone {
+		if containsFold(p.Headers, name) {
+			clone[name] = []string{p.mask()}
+		}
+	}
+	return clone
+}
+
+// RedactRequest 返回一个URL和header都被隐藏了敏感信息的request浅拷贝，原request不会被修改
+func (p *RedactionPolicy) RedactRequest(r *http.Request) *http.Request {
+	p = p.orDefault()
+	if r == nil {
+		return nil
+	}
+	clone := r.WithContext(r.Context())
+	if r.URL != nil {
+		u := *r.URL
+		u.Path = p.RedactString(u.Path)
+		// 保留转义形式，/files/a%2Fb 不能变成 /files/a/b
+		u.RawPath = p.RedactString(u.RawPath)
+		u.RawQuery = p.RedactQuery(u.RawQuery)
+		u.User = nil
+		clone.URL = &u
+	}
+	if r.RequestURI != "" {
+		uri, query := r.RequestURI, ""
+		if i := strings.Index(uri, "?"); i >= 0 {
+			uri, query = uri[:i], uri[i+1:]
+		}
+		clone.RequestURI = p.RedactString(uri)
+		if query != "" {
+			clone.RequestURI += "?" + p.RedactQuery(query)
+		}
+	}
+	clone.Header = p.RedactHeader(r.Header)
+	// 表单和原request共享，handler解析表单后同样需要隐藏，上传的文件不会保留
+	clone.Form = p.redactValues(r.Form)
+	clone.PostForm = p.redactValues(r.PostForm)
+	if r.MultipartForm != nil {
+		clone.MultipartForm = &multipart.Form{Value: p.redactValues(r.MultipartForm.Value)}
+	}
+	return clone
+}
+
+// redactValues 返回敏感参数的值被隐藏、其他值按规则替换的副本
+func (p *RedactionPolicy) redactValues(values map[string][]string) url.Values {
+	if values == nil {
+		return nil
+	}
+	clone := make(url.Values, len(values))
+	for name, list := range values {
+		redacted := make([]string, len(list))
+		for i, v := range list {
+			if containsFold(p.QueryParams, name) {
+				redacted[i] = p.mask()
+			} else {
+				redacted[i] = p.RedactString(v)
+			}
+		}
+		clone[name] = redacted
+	}
+	return clone
+}
+
+// RedactValue 返回隐藏了敏感信息的v的文本形式
+func (p *RedactionPolicy) RedactValue(v interface{}) string {
+	return p.RedactString(fmt.Sprint(v))
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package negroni
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func newSensitiveRequest() *http.Request {
+	req, _ := http.NewRequest("GET", "http://localhost:3000/orders?id=7&token=s3cr3t&Password=hunter2", nil)
+	req.Header.Set("Authorization", "Bearer abc.def.ghi")
+	req.Header.Set("Cookie", "session=xyz")
+	req.Header.Set("X-Request-Id", "42")
+	return req
+}
+
+func TestRedactionPolicyQuery(t *testing.T) {
+	var p *RedactionPolicy
+	expect(t, p.RedactQuery("id=7&token=s3cr3t&Password=hunter2&flag"), "id=7&token=[REDACTED]&Password=[REDACTED]&flag")
+
+	p = &RedactionPolicy{QueryParams: []string{"id"}, Mask: "***"}
+	expect(t, p.RedactQuery("id=7&token=s3cr3t"), "id=***&token=s3cr3t")
+
+	u, _ := url.Parse("/a?token=1")
+	expect(t, p.RedactURL(u), "/a?token=1")
+	expect(t, DefaultRedactionPolicy().RedactURL(u), "/a?token=[REDACTED]")
+}
+
+func TestRedactionPolicyRequest(t *testing.T) {
+	req := newSensitiveRequest()
+	clone := DefaultRedactionPolicy().RedactRequest(req)
+
+	expect(t, clone.Header.Get("Authorization"), DefaultRedactionMask)
+	expect(t, clone.Header.Get("Cookie"), DefaultRedactionMask)
+	expect(t, clone.Header.Get("X-Request-Id"), "42")
+	expect(t, clone.URL.Query().Get("token"), DefaultRedactionMask)
+	expect(t, clone.URL.Query().Get("id"), "7")
+
+	// 原request不能被修改
+	expect(t, req.Header.Get("Authorization"), "Bearer abc.def.ghi")
+	expect(t, req.URL.Query().Get("token"), "s3cr3t")
+}
+
+func TestRedactionPolicyPatterns(t *testing.T) {
+	p := DefaultRedactionPolicy()
+	expect(t, p.RedactString("auth failed for Bearer abc.def"), "auth failed for [REDACTED]")
+
+	p.Patterns = append(p.Patterns, regexp.MustCompile(`\d{4}-\d{4}-\d{4}-\d{4}`))
+	expect(t, p.RedactValue(errors.New("card 1234-5678-9012-3456 declined")), "card [REDACTED] declined")
+}
+
+func serveSensitivePanic(rec *Recovery) *httptest.ResponseRecorder {
+	n := New()
+	n.Use(rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic("login failed: password=hunter2")
+	}))
+	recorder := httptest.NewRecorder()
+	n.ServeHTTP(recorder, newSensitiveRequest())
+	return recorder
+}
+
+func TestRedactionTextPanicFormatter(t *testing.T) {
+	var buff bytes.Buffer
+	rec := NewRecovery()
+	rec.Logger = log.New(&buff, "", 0)
+
+	body := serveSensitivePanic(rec).Body.String()
+	expect(t, strings.Contains(body, "hunter2"), false)
+	expect(t, strings.Contains(body, "login failed: [REDACTED]"), true)
+	expect(t, strings.Contains(buff.String(), "hunter2"), false)
+}
+
+func TestRedactionHTMLPanicFormatter(t *testing.T) {
+	rec := NewRecovery()
+	rec.Logger = log.New(&bytes.Buffer{}, "", 0)
+	rec.Formatter = &HTMLPanicFormatter{}
+
+	body := serveSensitivePanic(rec).Body.String()
+	expect(t, strings.Contains(body, "hunter2"), false)
+	expect(t, strings.Contains(body, "s3cr3t"), false)
+	expect(t, strings.Contains(body, "GET /orders?id=7&amp;token=[REDACTED]"), true)
+}
+
+func TestRedactionCrashReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "negroni-redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rec := NewRecovery()
+	rec.Logger = log.New(&bytes.Buffer{}, "", 0)
+	rec.CrashReporter = NewFileCrashReporter(dir)
+	serveSensitivePanic(rec)
+
+	reports, err := ReadCrashReports(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, len(reports), 1)
+	for _, secret := range []string{"hunter2", "s3cr3t", "abc.def.ghi", "xyz"} {
+		expect(t, strings.Contains(reports[0].Panic+reports[0].Request, secret), false)
+	}
+	expect(t, strings.Contains(reports[0].Request, "X-Request-Id: 42"), true)
+}
+
+func TestRedactionLogger(t *testing.T) {
+	var buff bytes.Buffer
+	l := NewLogger()
+	l.ALogger = log.New(&buff, "", 0)
+	l.SetFormat(`{{.Request.URL}} {{.Request.Header.Get "Authorization"}} {{.Request.URL.Query.Get "id"}}`)
+
+	n := New()
+	n.Use(l)
+	n.ServeHTTP(httptest.NewRecorder(), newSensitiveRequest())
+
+	line := strings.TrimSpace(buff.String())
+	expect(t, line, "http://localhost:3000/orders?id=7&token=[REDACTED]&Password=[REDACTED] [REDACTED] 7")
+}
+
+func TestRedactionPolicyRequestForm(t *testing.T) {
+	req := httptest.NewRequest("POST", "/login?token=s3cr3t", strings.NewReader("user=bob&password=hunter2"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.ParseForm()
+
+	clone := DefaultRedactionPolicy().RedactRequest(req)
+	expect(t, clone.Form.Get("token"), DefaultRedactionMask)
+	expect(t, clone.Form.Get("password"), DefaultRedactionMask)
+	expect(t, clone.Form.Get("user"), "bob")
+	expect(t, clone.PostForm.Get("password"), DefaultRedactionMask)
+	expect(t, req.Form.Get("password"), "hunter2")
+
+	// handler解析表单后，Logger模板中看到的也是隐藏后的值
+	var buff bytes.Buffer
+	l := NewLogger()
+	l.ALogger = log.New(&buff, "", 0)
+	l.SetFormat(`{{.Request.Form}}`)
+	n := New(l)
+	n.UseHandlerFunc(func(rw http.ResponseWriter, r *http.Request) { r.ParseForm() })
+	req = httptest.NewRequest("GET", "/?token=s3cr3t", nil)
+	n.ServeHTTP(httptest.NewRecorder(), req)
+	expect(t, strings.TrimSpace(buff.String()), "map[token:[[REDACTED]]]")
+}
+
+func TestRedactionPolicyRequestKeepsEscapedPath(t *testing.T) {
+	req := httptest.NewRequest("GET", "/files/a%2Fb?token=1", nil)
+	clone := DefaultRedactionPolicy().RedactRequest(req)
+	expect(t, clone.URL.EscapedPath(), "/files/a%2Fb")
+	expect(t, clone.RequestURI, "/files/a%2Fb?token=[REDACTED]")
+
+	var buff bytes.Buffer
+	l := NewCommonLogger()
+	l.ALogger = log.New(&buff, "", 0)
+	New(l).ServeHTTP(httptest.NewRecorder(), req)
+	expect(t, strings.Contains(buff.String(), `"GET /files/a%2Fb?token=[REDACTED] HTTP/1.1"`), true)
+}
@@ -0,0 +1,184 @@
+package negroni
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultRequestIDHeader 是默认读取和返回请求ID的header
+const DefaultRequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength 是接受的外部请求ID的最大长度
+const maxRequestIDLength = 128
+
+// requestIDContextKey 是请求ID保存在request context中的key
+type requestIDContextKey struct{}
+
+// requestIDRecorderKey 是排在RequestID之前的中间件接收请求ID的key
+type requestIDRecorderKey struct{}
+
+// RequestID 是为每个请求读取或生成请求ID的中间件。
+// 请求ID会保存到request context中并写入response header，
+// Recovery和RequestIDTransport从request context中读取它，所以它应该放在这些中间件之前。
+// Logger不受顺序和Header的影响，放在RequestID之前时也能记录请求ID
+type RequestID struct {
+	// Header 是读取和返回请求ID的header
+	Header string
+	// Generator 生成新的请求ID，默认是NewUUID，也可以使用NewULID
+	Generator func() string
+	// TrustIncoming 为true时使用客户端传入的合法请求ID，而不是生成新的
+	TrustIncoming bool
+}
+
+// NewRequestID 返回一个新的RequestID实例
+func NewRequestID() *RequestID {
+	return &RequestID{
+		Header:        DefaultRequestIDHeader,
+		Generator:     NewUUID,
+		TrustIncoming: true,
+	}
+}
+
+func (m *RequestID) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	header := m.Header
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+
+	id := ""
+	if m.TrustIncoming {
+		if incoming := r.Header.Get(header); validRequestID(incoming) {
+			id = incoming
+		}
+	}
+	if id == "" {
+		generate := m.Generator
+		if generate == nil {
+			generate = NewUUID
+		}
+		id = generate()
+	}
+
+	if recorded, ok := r.Context().Value(requestIDRecorderKey{}).(*string); ok {
+		*recorded = id
+	}
+	rw.Header().Set(header, id)
+	next(rw, r.WithContext(WithRequestID(r.Context(), id)))
+}
+
+// validRequestID 只接受不会破坏日志格式的请求ID
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// WithRequestID 返回一个保存了请求ID的context
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// withRequestIDRecorder 返回一个context，后面的RequestID中间件会把请求ID写入recorded，
+// 排在RequestID之前的中间件可以在next返回后读取它，不需要知道RequestID使用的header
+func withRequestIDRecorder(ctx context.Context, recorded *string) context.Context {
+	return context.WithValue(ctx, requestIDRecorderKey{}, recorded)
+}
+
+// RequestIDFromContext 返回context中的请求ID，没有时返回空字符串
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// RequestIDFromRequest 返回请求的请求ID，没有时返回空字符串
+func RequestIDFromRequest(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	return RequestIDFromContext(r.Context())
+}
+
+// RequestIDTransport 是一个http.RoundTripper，它把request context中的请求ID转发给下游服务
+type RequestIDTransport struct {
+	// Base 是实际发送请求的RoundTripper，为nil时使用http.DefaultTransport
+	Base http.RoundTripper
+	// Header 是转发请求ID使用的header，为空时使用DefaultRequestIDHeader
+	Header string
+}
+
+// RoundTrip 实现http.RoundTripper接口方法
+func (t *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	header := t.Header
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+
+	// RoundTripper不能修改传入的request
+	if id := RequestIDFromRequest(req); id != "" && req.Header.Get(header) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(header, id)
+	}
+	return base.RoundTrip(req)
+}
+
+// NewUUID 返回一个随机的UUID(version 4)
+func NewUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// crockfordBase32 是ULID使用的字母表
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID 返回一个ULID，它以毫秒时间戳开头，按字典序排序即按生成时间排序
+func NewULID() string {
+	return newULID(time.Now())
+}
+
+func newULID(t time.Time) string {
+	var b [16]byte
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint16(b[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic(err)
+	}
+
+	// 128位数据编码为26个字符，最高位补两个0
+	out := make([]byte, 26)
+	for i := range out {
+		bit := i*5 - 2
+		var v byte
+		for j := 0; j < 5; j++ {
+			v <<= 1
+			if n := bit + j; n >= 0 && b[n/8]&(0x80>>(uint(n)%8)) != 0 {
+				v |= 1
+			}
+		}
+		out[i] = crockfordBase32[v]
+	}
+	return string(out)
+}
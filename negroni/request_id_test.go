@@ -0,0 +1,135 @@
+package negroni
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewUUID(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	id := NewUUID()
+	expect(t, pattern.MatchString(id), true)
+	refute(t, NewUUID(), id)
+}
+
+func TestNewULID(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)
+	id := NewULID()
+	expect(t, pattern.MatchString(id), true)
+
+	// 时间部分决定了排序
+	earlier := newULID(time.Unix(1000, 0))
+	later := newULID(time.Unix(2000, 0))
+	expect(t, earlier < later, true)
+	expect(t, newULID(time.Unix(0, 0))[:10], "0000000000")
+	expect(t, newULID(time.Unix(1469918176, 385*int64(time.Millisecond)))[:10], "01ARYZ6S41")
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	n := New(NewRequestID())
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromRequest(r)
+	}))
+
+	recorder := httptest.NewRecorder()
+	n.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	refute(t, seen, "")
+	expect(t, recorder.Header().Get(DefaultRequestIDHeader), seen)
+
+	recorder = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(DefaultRequestIDHeader, "upstream-42")
+	n.ServeHTTP(recorder, req)
+	expect(t, seen, "upstream-42")
+
+	// 可能破坏日志的ID会被替换
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(DefaultRequestIDHeader, "bad id\n")
+	n.ServeHTTP(httptest.NewRecorder(), req)
+	refute(t, seen, "bad id\n")
+}
+
+func TestRequestIDCustomHeader(t *testing.T) {
+	m := &RequestID{Header: "X-Correlation-Id", Generator: func() string { return "fixed" }}
+	var seen string
+	n := New(m)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromRequest(r)
+	}))
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Correlation-Id", "ignored")
+	n.ServeHTTP(recorder, req)
+	expect(t, seen, "fixed")
+	expect(t, recorder.Header().Get("X-Correlation-Id"), "fixed")
+}
+
+func TestRequestIDInLoggerAndRecovery(t *testing.T) {
+	var logs, panics bytes.Buffer
+	l := NewLogger()
+	l.ALogger = log.New(&logs, "", 0)
+	l.Formatter = &JSONLogFormatter{}
+	rec := NewRecovery()
+	rec.Logger = log.New(&panics, "", 0)
+	rec.Formatter = &HTMLPanicFormatter{}
+	var infos *PanicInformation
+	rec.PaincHandlerFunc = func(i *PanicInformation) { infos = i }
+
+	n := New(l, &RequestID{Generator: func() string { return "req-1" }}, rec)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic("with id")
+	}))
+	recorder := httptest.NewRecorder()
+	n.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	expect(t, infos.RequestID, "req-1")
+	expect(t, strings.Contains(recorder.Body.String(), "req-1"), true)
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, decoded["request_id"], "req-1")
+}
+
+func TestRequestIDCustomHeaderInLogger(t *testing.T) {
+	var logs bytes.Buffer
+	l := NewLogger()
+	l.ALogger = log.New(&logs, "", 0)
+	l.SetFormat("{{.RequestID}}")
+
+	n := New(l, &RequestID{Header: "X-Correlation-Id", Generator: func() string { return "req-2" }})
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	n.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	expect(t, strings.TrimSpace(logs.String()), "req-2")
+}
+
+func TestRequestIDTransport(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(DefaultRequestIDHeader)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &RequestIDTransport{}}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req = req.WithContext(WithRequestID(req.Context(), "abc-123"))
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	expect(t, received, "abc-123")
+	// 原request没有被修改
+	expect(t, req.Header.Get(DefaultRequestIDHeader), "")
+}
@@ -0,0 +1,166 @@
+package negroni
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// StackFrame 是堆栈中的一帧调用信息
+type StackFrame struct {
+	// Function 是函数的完整名称，例如 net/http.(*conn).serve
+	Function string
+	// File 是函数所在源文件的路径
+	File string
+	// Line 是调用所在的行号
+	Line int
+	// Stdlib 表示这一帧是否来自go标准库
+	Stdlib bool
+	// CreatedBy 表示这一帧是创建该goroutine的调用点
+	CreatedBy bool
+	// Source 是调用点附近的源代码，只有在加载过源码后才有值
+	Source []SourceLine
+}
+
+// SourceLine 是源文件中的一行
+type SourceLine struct {
+	Number  int
+	Code    string
+	Current bool
+}
+
+// Goroutine 是堆栈中的一个goroutine及其所有调用帧
+type Goroutine struct {
+	ID     int
+	State  string
+	Frames []StackFrame
+}
+
+// ParseStack 把runtime.Stack输出的原始堆栈解析成goroutine和调用帧
+// 无法识别的行会被忽略
+func ParseStack(stack []byte) []Goroutine {
+	var (
+		goroutines []Goroutine
+		current    *Goroutine
+		frame      *StackFrame
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(stack))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "goroutine "):
+			goroutines = append(goroutines, parseGoroutineHeader(line))
+			current = &goroutines[len(goroutines)-1]
+			frame = nil
+		case current == nil || strings.TrimSpace(line) == "":
+			continue
+		case strings.HasPrefix(line, "\t"):
+			// 文件位置行，属于上一个函数行
+			if frame == nil {
+				continue
+			}
+			frame.File, frame.Line = parseFileLine(line)
+			frame.Stdlib = isStdlibFile(frame.File)
+			current.Frames = append(current.Frames, *frame)
+			frame = nil
+		default:
+			frame = parseFunctionLine(line)
+		}
+	}
+	return goroutines
+}
+
+// parseGoroutineHeader 解析形如 "goroutine 1 [running]:" 的行
+func parseGoroutineHeader(line string) Goroutine {
+	g := Goroutine{}
+	fields := strings.SplitN(strings.TrimSuffix(line, ":"), " ", 3)
+	if len(fields) > 1 {
+		g.ID, _ = strconv.Atoi(fields[1])
+	}
+	if len(fields) > 2 {
+		g.State = strings.Trim(fields[2], "[]")
+	}
+	return g
+}
+
+// parseFunctionLine 解析函数行，去掉末尾的参数列表
+func parseFunctionLine(line string) *StackFrame {
+	frame := &StackFrame{}
+	if strings.HasPrefix(line, "created by ") {
+		frame.CreatedBy = true
+		line = strings.TrimPrefix(line, "created by ")
+		// go1.21开始会追加 " in goroutine N"
+		if i := strings.Index(line, " in goroutine "); i >= 0 {
+			line = line[:i]
+		}
+	} else if strings.HasSuffix(line, ")") {
+		if i := strings.LastIndex(line, "("); i > 0 {
+			line = line[:i]
+		}
+	}
+	frame.Function = line
+	return frame
+}
+
+// parseFileLine 解析形如 "\t/path/file.go:10 +0x1d" 的行
+func parseFileLine(line string) (string, int) {
+	line = strings.TrimSpace(line)
+	if i := strings.LastIndex(line, " +0x"); i >= 0 {
+		line = line[:i]
+	}
+	i := strings.LastIndex(line, ":")
+	if i < 0 {
+		return line, 0
+	}
+	n, err := strconv.Atoi(line[i+1:])
+	if err != nil {
+		return line, 0
+	}
+	return line[:i], n
+}
+
+func isStdlibFile(file string) bool {
+	goroot := runtime.GOROOT()
+	if goroot == "" {
+		return false
+	}
+	return strings.HasPrefix(filepath.ToSlash(file), filepath.ToSlash(goroot)+"/src/")
+}
+
+// readSourceLines 读取file中line附近前后各context行的源代码
+// 读取失败时返回nil
+func readSourceLines(file string, line, context int) []SourceLine {
+	if line <= 0 || context < 0 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(string(data), "\n")
+	if line > len(lines) {
+		return nil
+	}
+
+	start, end := line-context, line+context
+	if start < 1 {
+		start = 1
+	}
+	if end > len(lines) {
+		end = len(lines)
+	}
+	source := make([]SourceLine, 0, end-start+1)
+	for n := start; n <= end; n++ {
+		source = append(source, SourceLine{
+			Number:  n,
+			Code:    strings.TrimRight(lines[n-1], "\r"),
+			Current: n == line,
+		})
+	}
+	return source
+}
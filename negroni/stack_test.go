@@ -0,0 +1,71 @@
+package negroni
+
+import (
+	"runtime"
+	"testing"
+)
+
+const sampleStack = `goroutine 7 [running]:
+GolangStudyNotes/negroni.(*Recovery).ServeHTTP.func1(0xc0000a4000, 0x1)
+	/home/user/negroni/recovery.go:150 +0x8b
+panic(0x6a1b40, 0x7d2f10)
+	/usr/local/go/src/runtime/panic.go:679 +0x1b2
+main.main.func1(...)
+	/home/user/app/main.go:12
+created by net/http.(*Server).Serve in goroutine 1
+	/usr/local/go/src/net/http/server.go:3285 +0x4b4
+
+goroutine 1 [IO wait]:
+main.main()
+	/home/user/app/main.go:20 +0x25
+`
+
+func TestParseStack(t *testing.T) {
+	goroutines := ParseStack([]byte(sampleStack))
+	expect(t, len(goroutines), 2)
+
+	g := goroutines[0]
+	expect(t, g.ID, 7)
+	expect(t, g.State, "running")
+	expect(t, len(g.Frames), 4)
+
+	expect(t, g.Frames[0].Function, "GolangStudyNotes/negroni.(*Recovery).ServeHTTP.func1")
+	expect(t, g.Frames[0].File, "/home/user/negroni/recovery.go")
+	expect(t, g.Frames[0].Line, 150)
+	expect(t, g.Frames[1].Function, "panic")
+	expect(t, g.Frames[2].Function, "main.main.func1")
+	expect(t, g.Frames[2].Line, 12)
+	expect(t, g.Frames[3].Function, "net/http.(*Server).Serve")
+	expect(t, g.Frames[3].CreatedBy, true)
+
+	expect(t, goroutines[1].State, "IO wait")
+	expect(t, goroutines[1].Frames[0].Function, "main.main")
+}
+
+func TestParseStackRuntime(t *testing.T) {
+	stack := make([]byte, 8*1024)
+	stack = stack[:runtime.Stack(stack, false)]
+
+	goroutines := ParseStack(stack)
+	expect(t, len(goroutines), 1)
+	frames := goroutines[0].Frames
+	refute(t, len(frames), 0)
+	expect(t, frames[0].Function, "GolangStudyNotes/negroni.TestParseStackRuntime")
+	expect(t, frames[0].Stdlib, false)
+
+	last := frames[len(frames)-1]
+	expect(t, last.CreatedBy, true)
+	expect(t, last.Stdlib, true)
+}
+
+func TestReadSourceLines(t *testing.T) {
+	_, file, line, _ := runtime.Caller(0)
+	source := readSourceLines(file, line, 2)
+	expect(t, len(source), 5)
+	expect(t, source[2].Current, true)
+	expect(t, source[2].Number, line)
+	expect(t, source[2].Code, "\t_, file, line, _ := runtime.Caller(0)")
+
+	expect(t, len(readSourceLines(file, 1, 2)), 3)
+	expect(t, len(readSourceLines("/does/not/exist.go", 1, 2)), 0)
+}
@@ -1,11 +1,29 @@
 package negroni
 
 import (
+	"io"
+	"mime"
 	"net/http"
+	"os"
 	"path"
+	"strconv"
 	"strings"
 )
 
+// StaticEncoding 是一种预压缩文件的编码
+type StaticEncoding struct {
+	// Name 是Accept-Encoding和Content-Encoding中使用的名称，例如gzip
+	Name string
+	// Ext 是预压缩文件相对于原文件增加的扩展名，例如.gz
+	Ext string
+}
+
+// DefaultStaticEncodings 是NewStatic默认查找的预压缩文件，按优先级排列
+var DefaultStaticEncodings = []StaticEncoding{
+	{Name: "br", Ext: ".br"},
+	{Name: "gzip", Ext: ".gz"},
+}
+
 // Static 是为给定目录/文件系统中的静态文件提供服务的中间件处理程序。如果文件系统上不存在该文件，则
 // 传递到链中的下一个中间件。如果你想要“文件服务器”
 // 当它为未找到的文件返回404时，您应该考虑
@@ -17,6 +35,43 @@ type Static struct {
 	Prefix string
 	// IndexFile 定义要用作索引的文件（如果存在）。
 	IndexFile string
+	// Browse 为true时，没有IndexFile的目录会返回目录列表，而不是交给下一个中间件
+	Browse bool
+	// ShowHidden 为true时允许访问以.开头的文件和目录，并在目录列表中显示它们，
+	// 默认会拒绝这类请求，避免泄露.git、.env等文件
+	ShowHidden bool
+	// Deny 是拒绝访问的路径规则，包含/时匹配完整路径及其上级目录，否则匹配路径中的任意一段，
+	// 例如 "*.bak"、".git"、"/private"
+	Deny []string
+	// Allow 是允许访问的路径规则，格式与Deny相同，只对它匹配的那一段路径优先于Deny和隐藏文件的限制，
+	// 例如 "/.well-known" 放行 /.well-known/security.txt，但 "*.txt" 不会放行 /.git/notes.txt
+	Allow []string
+	// DenyStatus 是被拒绝的请求返回的状态码，例如404，为0时交给下一个中间件。
+	// 符号链接指向Dir之外的文件(只检查http.Dir)时同样按被拒绝处理
+	DenyStatus int
+	// Fallback 不为空时开启单页应用模式：GET请求没有匹配到文件、路径没有扩展名、
+	// 客户端接受HTML并且不在FallbackExclude之下时，返回这个文件(例如/index.html)
+	Fallback string
+	// FallbackExclude 是不使用Fallback的路径前缀(例如/api)，与完整的请求路径比较
+	FallbackExclude []string
+	// CachePolicies 是按顺序匹配的缓存策略，第一个匹配文件的策略决定Cache-Control
+	CachePolicies []CachePolicy
+	// Manifest 不为nil时，其中带hash的文件名总是使用一年的不可变缓存，优先于CachePolicies
+	Manifest AssetManifest
+	// ETag 为true时根据文件内容的hash设置强ETag，并正确处理If-None-Match，默认关闭，只使用Last-Modified。
+	// 文件第一次被请求时同步读取整个文件计算hash，结果按文件的修改时间和大小缓存，
+	// 所以替换文件时如果保留了修改时间和大小(例如 cp -p、rsync -t)，会继续返回旧的ETag，直到重新创建Static
+	ETag bool
+	// ETagMaxSize 是计算ETag的最大文件大小，更大的文件不设置ETag，为0时使用DefaultETagMaxSize
+	ETagMaxSize int64
+	// Encodings 是按优先级排列的预压缩编码，客户端接受某种编码并且存在
+	// 对应的文件(例如app.js.gz)时，会返回这个文件并设置Content-Encoding
+	Encodings []StaticEncoding
+
+	etags etagCache
+	root  realRootCache
+	// reload 只由NewDevStatic设置
+	reload *liveReload
 }
 
 // NewStatic 返回一个新的 Static实例
@@ -25,6 +80,8 @@ func NewStatic(directory http.FileSystem) *Static {
 		Dir:       directory,
 		Prefix:    "",
 		IndexFile: "index.html",
+		Deny:      append([]string(nil), DefaultStaticDeny...),
+		Encodings: append([]StaticEncoding(nil), DefaultStaticEncodings...),
 	}
 }
 
@@ -47,8 +104,20 @@ func (s *Static) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.Ha
 		}
 	}
 
-	f, err := s.Dir.Open(file)
+	if s.reload != nil && file == s.reload.options.Path {
+		s.reload.serveEvents(rw, r)
+		return
+	}
+
+	f, err := s.open(file)
+	if err == errStaticDenied {
+		s.serveDenied(rw, r, next)
+		return
+	}
 	if err != nil {
+		if s.serveFallback(rw, r, file) {
+			return
+		}
 		// discard the error?
 		next(rw, r)
 		return
@@ -68,9 +137,14 @@ func (s *Static) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.Ha
 			return
 		}
 
+		dir, dirName := f, file
 		file = path.Join(file, s.IndexFile)
-		f, err = s.Dir.Open(file)
+		f, err = s.open(file)
 		if err != nil {
+			if s.Browse {
+				s.serveListing(rw, r, dirName, dir)
+				return
+			}
 			next(rw, r)
 			return
 		}
@@ -83,5 +157,143 @@ func (s *Static) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.Ha
 		}
 	}
 
-	http.ServeContent(rw, r, file, fi.ModTime(), f)
+	s.serveFile(rw, r, file, f, fi)
+}
+
+// serveFile 返回file的内容，客户端支持时优先返回预压缩版本，开发模式下HTML页面会注入刷新脚本
+func (s *Static) serveFile(rw http.ResponseWriter, r *http.Request, file string, f http.File, fi os.FileInfo) {
+	if s.reload != nil && isHTMLFile(file) {
+		s.reload.serveHTML(rw, r, s.Prefix+s.reload.options.Path, file, f, fi)
+		return
+	}
+	if s.serveEncoded(rw, r, file, f) {
+		return
+	}
+	s.serveContent(rw, r, file, file, f, fi)
+}
+
+// serveContent 设置缓存相关的header后返回内容。
+// name是逻辑文件名，用于匹配缓存策略和判断类型；served是实际读取的文件，用于计算ETag
+func (s *Static) serveContent(rw http.ResponseWriter, r *http.Request, name, served string, f http.File, fi os.FileInfo) {
+	if s.Manifest.Contains(name) {
+		rw.Header().Set("Cache-Control", immutableCachePolicy.header())
+	} else if policy := s.cachePolicy(name); policy != nil {
+		rw.Header().Set("Cache-Control", policy.header())
+	}
+	if s.ETag {
+		if etag, ok := s.etag(r, served, f, fi); ok {
+			rw.Header().Set("ETag", etag)
+		}
+	}
+	http.ServeContent(rw, r, name, fi.ModTime(), f)
+}
+
+// serveFallback 在单页应用模式下为没有匹配到文件的请求返回Fallback，成功时返回true
+func (s *Static) serveFallback(rw http.ResponseWriter, r *http.Request, file string) bool {
+	if s.Fallback == "" || r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+	// 有扩展名的路径一般是资源文件，缺失时应该得到404而不是页面
+	if path.Ext(file) != "" || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return false
+	}
+	for _, prefix := range s.FallbackExclude {
+		if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, strings.TrimSuffix(prefix, "/")+"/") {
+			return false
+		}
+	}
+
+	f, err := s.open(s.Fallback)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		return false
+	}
+	s.serveFile(rw, r, s.Fallback, f, fi)
+	return true
+}
+
+// serveEncoded 尝试返回file的预压缩版本，成功时返回true。
+// 原文件f用于在无法从扩展名判断类型时探测Content-Type
+func (s *Static) serveEncoded(rw http.ResponseWriter, r *http.Request, file string, f http.File) bool {
+	if len(s.Encodings) == 0 {
+		return false
+	}
+	// 无论返回哪个版本，response都随Accept-Encoding变化
+	rw.Header().Add("Vary", "Accept-Encoding")
+
+	// Range是针对原始内容的，这种请求总是返回原文件
+	if r.Header.Get("Range") != "" {
+		return false
+	}
+
+	accepted := parseQualityValues(r.Header.Get("Accept-Encoding"))
+	for _, enc := range s.Encodings {
+		if !acceptsEncoding(accepted, enc.Name) {
+			continue
+		}
+		ef, err := s.open(file + enc.Ext)
+		if err != nil {
+			continue
+		}
+		defer ef.Close()
+		efi, err := ef.Stat()
+		if err != nil || efi.IsDir() {
+			continue
+		}
+
+		if rw.Header().Get("Content-Type") == "" {
+			rw.Header().Set("Content-Type", contentType(file, f))
+		}
+		rw.Header().Set("Content-Encoding", enc.Name)
+		s.serveContent(rw, r, file, file+enc.Ext, ef, efi)
+		return true
+	}
+	return false
+}
+
+// contentType 根据文件扩展名判断类型，无法判断时读取文件开头探测
+func contentType(name string, f http.File) string {
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		return ctype
+	}
+	var buf [512]byte
+	n, _ := io.ReadFull(f, buf[:])
+	f.Seek(0, io.SeekStart)
+	return http.DetectContentType(buf[:n])
+}
+
+// parseQualityValues 解析Accept、Accept-Encoding这类带q值的header，返回名称到q值的映射
+func parseQualityValues(header string) map[string]float64 {
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		accepted[name] = q
+	}
+	return accepted
+}
+
+// acceptsEncoding 返回客户端是否接受name编码，q=0表示明确拒绝
+func acceptsEncoding(accepted map[string]float64, name string) bool {
+	if q, ok := accepted[strings.ToLower(name)]; ok {
+		return q > 0
+	}
+	q, ok := accepted["*"]
+	return ok && q > 0
 }
@@ -0,0 +1,175 @@
+package negroni
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const browseHTML = `<html>
+<head><title>Index of {{.Path}}</title></head>
+<style type="text/css">
+html, body {
+	font-family: Helvetica, Arial, Sans;
+	color: #333333;
+	background-color: #ffffff;
+	margin: 0px;
+}
+h1 {
+	padding: 20px;
+	border-bottom: 1px solid #2b3848;
+}
+table {
+	margin: 2em;
+	border-collapse: collapse;
+}
+th, td {
+	padding: 0.3em 1.5em 0.3em 0;
+	text-align: left;
+}
+td.size, td.modtime {
+	font-family: monospace;
+	color: #6a737d;
+}
+</style>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+	<tr>
+		<th><a href="?sort=name&amp;order={{.NextOrder "name"}}">Name</a></th>
+		<th><a href="?sort=size&amp;order={{.NextOrder "size"}}">Size</a></th>
+		<th><a href="?sort=mtime&amp;order={{.NextOrder "mtime"}}">Modified</a></th>
+	</tr>
+	{{ if ne .Path "/" }}<tr><td><a href="../">../</a></td><td></td><td></td></tr>{{ end }}
+	{{ range .Entries }}
+	<tr>
+		<td><a href="{{.URL}}">{{.Name}}{{ if .IsDir }}/{{ end }}</a></td>
+		<td class="size">{{ if not .IsDir }}{{.Size}}{{ end }}</td>
+		<td class="modtime">{{.ModTime.Format "2006-01-02 15:04:05"}}</td>
+	</tr>
+	{{ end }}
+</table>
+</body>
+</html>`
+
+var browseHTMLTemplate = template.Must(template.New("DirectoryListing").Parse(browseHTML))
+
+// DirectoryEntry 是目录列表中的一项
+type DirectoryEntry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	IsDir   bool      `json:"is_dir"`
+	// URL 是相对于当前目录的链接
+	URL string `json:"url"`
+}
+
+// DirectoryListing 是目录列表页面的数据，也是json格式的输出
+type DirectoryListing struct {
+	Path    string           `json:"path"`
+	Sort    string           `json:"sort"`
+	Order   string           `json:"order"`
+	Entries []DirectoryEntry `json:"entries"`
+}
+
+// NextOrder 返回点击某一列时的排序方向，再次点击当前排序的列会反转顺序
+func (l *DirectoryListing) NextOrder(column string) string {
+	if l.Sort == column && l.Order == "asc" {
+		return "desc"
+	}
+	return "asc"
+}
+
+// serveListing 输出目录dir的内容，客户端接受json时输出json，否则输出HTML，name是dir在Dir中的路径
+// 请求可以通过 ?sort=name|size|mtime&order=asc|desc 指定排序方式
+func (s *Static) serveListing(rw http.ResponseWriter, r *http.Request, name string, dir http.File) {
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		http.Error(rw, "failed to read directory", http.StatusInternalServerError)
+		return
+	}
+
+	listing := &DirectoryListing{
+		Path:  r.URL.Path,
+		Sort:  r.URL.Query().Get("sort"),
+		Order: r.URL.Query().Get("order"),
+	}
+	if listing.Sort != "size" && listing.Sort != "mtime" {
+		listing.Sort = "name"
+	}
+	if listing.Order != "desc" {
+		listing.Order = "asc"
+	}
+
+	for _, fi := range infos {
+		// 被拒绝的文件不出现在列表中
+		if s.denied(path.Join(name, fi.Name())) {
+			continue
+		}
+		listing.Entries = append(listing.Entries, newDirectoryEntry(fi))
+	}
+	sortDirectoryEntries(listing.Entries, listing.Sort, listing.Order == "desc")
+
+	if wantsJSON(r) {
+		if listing.Entries == nil {
+			listing.Entries = []DirectoryEntry{}
+		}
+		rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(rw).Encode(listing)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	browseHTMLTemplate.Execute(rw, listing)
+}
+
+func newDirectoryEntry(fi os.FileInfo) DirectoryEntry {
+	name := fi.Name()
+	// url.URL会转义特殊字符，并且在文件名含有冒号时加上./，避免被当作协议
+	link := (&url.URL{Path: name}).String()
+	if fi.IsDir() {
+		link += "/"
+	}
+	return DirectoryEntry{
+		Name:    name,
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+		IsDir:   fi.IsDir(),
+		URL:     link,
+	}
+}
+
+// sortDirectoryEntries 排序目录项，目录总是在文件前面
+func sortDirectoryEntries(entries []DirectoryEntry, by string, desc bool) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		if desc {
+			a, b = b, a
+		}
+		switch by {
+		case "size":
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case "mtime":
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime)
+			}
+		}
+		return a.Name < b.Name
+	})
+}
+
+// wantsJSON 返回客户端是否更想要json而不是HTML
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
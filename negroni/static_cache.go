@@ -0,0 +1,158 @@
+package negroni
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fingerprintPattern 匹配 app.3f2a1c9d.js 这样文件名中带有内容hash的文件
+var fingerprintPattern = regexp.MustCompile(`\.([0-9a-fA-F]{8,})\.[^./]+$`)
+
+// IsFingerprinted 返回文件名中是否带有内容hash，例如 app.3f2a1c9d.js。
+// hash至少8位并且至少包含一个a-f的字母，这样 report.20190101.csv 这类带日期或编号的文件不会被当作带hash。
+// 极少数全是数字的hash不会被识别，Static.Manifest中的文件不受影响
+func IsFingerprinted(name string) bool {
+	match := fingerprintPattern.FindStringSubmatch(path.Base(name))
+	return match != nil && strings.ContainsAny(match[1], "abcdefABCDEF")
+}
+
+// CachePolicy 是一组文件的缓存策略
+type CachePolicy struct {
+	// Pattern 是path.Match格式的匹配规则，包含/时匹配完整路径，否则只匹配文件名，
+	// 例如 "*.css"、"/fonts/*"、"index.html"，为空时匹配所有文件
+	Pattern string
+	// Fingerprinted 为true时只匹配文件名中带有内容hash的文件
+	Fingerprinted bool
+	// MaxAge 是缓存时间
+	MaxAge time.Duration
+	// Immutable 告诉浏览器在MaxAge内不需要重新验证
+	Immutable bool
+	// NoCache 要求浏览器每次使用前都重新验证，设置后忽略MaxAge和Immutable
+	NoCache bool
+}
+
+// immutableCachePolicy 是带hash的文件使用的策略
+var immutableCachePolicy = CachePolicy{MaxAge: 365 * 24 * time.Hour, Immutable: true}
+
+// DefaultCachePolicies 返回常用的缓存策略：带hash的文件缓存一年且不可变，
+// HTML页面每次都要重新验证
+func DefaultCachePolicies() []CachePolicy {
+	return []CachePolicy{
+		{Fingerprinted: true, MaxAge: immutableCachePolicy.MaxAge, Immutable: true},
+		{Pattern: "*.html", NoCache: true},
+	}
+}
+
+// Match 返回策略是否适用于name
+func (p *CachePolicy) Match(name string) bool {
+	if p.Fingerprinted && !IsFingerprinted(name) {
+		return false
+	}
+	if p.Pattern == "" {
+		return true
+	}
+	target := path.Base(name)
+	if strings.Contains(p.Pattern, "/") {
+		target = name
+	}
+	ok, _ := path.Match(p.Pattern, target)
+	return ok
+}
+
+// header 返回Cache-Control的值
+func (p *CachePolicy) header() string {
+	if p.NoCache {
+		return "no-cache"
+	}
+	value := "public, max-age=" + strconv.FormatInt(int64(p.MaxAge/time.Second), 10)
+	if p.Immutable {
+		value += ", immutable"
+	}
+	return value
+}
+
+// cachePolicy 返回第一个匹配name的策略，没有时返回nil
+func (s *Static) cachePolicy(name string) *CachePolicy {
+	for i := range s.CachePolicies {
+		if s.CachePolicies[i].Match(name) {
+			return &s.CachePolicies[i]
+		}
+	}
+	return nil
+}
+
+// DefaultETagMaxSize 是Static.ETagMaxSize为0时计算ETag的最大文件大小
+const DefaultETagMaxSize = 8 << 20
+
+// etag 返回served的ETag。超过ETagMaxSize的文件不计算；
+// Range请求只使用已经缓存的ETag，不为了一部分内容读取整个文件
+func (s *Static) etag(r *http.Request, served string, f http.File, fi os.FileInfo) (string, bool) {
+	maxSize := s.ETagMaxSize
+	if maxSize == 0 {
+		maxSize = DefaultETagMaxSize
+	}
+	if fi.Size() > maxSize {
+		return "", false
+	}
+	if etag, ok := s.etags.lookup(served, fi); ok {
+		return etag, true
+	}
+	if r.Header.Get("Range") != "" {
+		return "", false
+	}
+	etag, err := s.etags.compute(served, f, fi)
+	return etag, err == nil
+}
+
+// etagCache 缓存文件内容的hash，文件的修改时间或大小变化时重新计算。
+// 修改时间和大小都没有变化的文件被认为内容没有变化
+type etagCache struct {
+	mutex   sync.Mutex
+	entries map[string]etagEntry
+}
+
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// lookup 返回缓存中仍然有效的ETag
+func (c *etagCache) lookup(name string, fi os.FileInfo) (string, bool) {
+	c.mutex.Lock()
+	entry, ok := c.entries[name]
+	c.mutex.Unlock()
+	if ok && entry.modTime.Equal(fi.ModTime()) && entry.size == fi.Size() {
+		return entry.etag, true
+	}
+	return "", false
+}
+
+// compute 计算并缓存文件的强ETag，计算后会把f重置到开头
+func (c *etagCache) compute(name string, f http.File, fi os.FileInfo) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16]) + `"`
+
+	c.mutex.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]etagEntry)
+	}
+	c.entries[name] = etagEntry{modTime: fi.ModTime(), size: fi.Size(), etag: etag}
+	c.mutex.Unlock()
+	return etag, nil
+}
@@ -0,0 +1,154 @@
+package negroni
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsFingerprinted(t *testing.T) {
+	expect(t, IsFingerprinted("/js/app.3f2a1c9d.js"), true)
+	expect(t, IsFingerprinted("app.3F2A1C9D.min.css"), false)
+	expect(t, IsFingerprinted("app.min.3f2a1c9d.css"), true)
+	expect(t, IsFingerprinted("app.js"), false)
+	expect(t, IsFingerprinted("app.3f2a.js"), false)
+	expect(t, IsFingerprinted("/3f2a1c9d.d/app.js"), false)
+	// 日期和编号不是hash
+	expect(t, IsFingerprinted("report.20190101.csv"), false)
+	expect(t, IsFingerprinted("backup.123456.tar"), false)
+	expect(t, IsFingerprinted("app.3f2a1c.js"), false)
+	expect(t, IsFingerprinted("dump.1234567890123.sql"), false)
+}
+
+func TestCachePolicyMatch(t *testing.T) {
+	expect(t, (&CachePolicy{Pattern: "*.css"}).Match("/css/app.css"), true)
+	expect(t, (&CachePolicy{Pattern: "*.css"}).Match("/css/app.js"), false)
+	expect(t, (&CachePolicy{Pattern: "/fonts/*"}).Match("/fonts/a.woff2"), true)
+	expect(t, (&CachePolicy{Pattern: "/fonts/*"}).Match("/css/fonts/a.woff2"), false)
+	expect(t, (&CachePolicy{}).Match("/anything"), true)
+	expect(t, (&CachePolicy{Pattern: "*.js", Fingerprinted: true}).Match("/app.js"), false)
+	expect(t, (&CachePolicy{Pattern: "*.js", Fingerprinted: true}).Match("/app.3f2a1c9d.js"), true)
+
+	expect(t, (&CachePolicy{MaxAge: time.Hour}).header(), "public, max-age=3600")
+	expect(t, (&CachePolicy{MaxAge: time.Minute, Immutable: true}).header(), "public, max-age=60, immutable")
+	expect(t, (&CachePolicy{MaxAge: time.Hour, NoCache: true}).header(), "no-cache")
+}
+
+func TestStaticCachePolicies(t *testing.T) {
+	dir := newStaticDir(t, map[string]string{
+		"index.html":       "<app/>",
+		"app.3f2a1c9d.js":  "js",
+		"css/site.css":     "body{}",
+		"robots.txt":       "",
+		"app.3f2a1c9d.css": "css",
+	})
+	defer os.RemoveAll(dir)
+	s := NewStatic(http.Dir(dir))
+	s.CachePolicies = append(DefaultCachePolicies(), CachePolicy{Pattern: "*.css", MaxAge: time.Hour})
+
+	recorder := serveStatic(s, httptest.NewRequest("GET", "/app.3f2a1c9d.js", nil))
+	expect(t, recorder.Header().Get("Cache-Control"), "public, max-age=31536000, immutable")
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/app.3f2a1c9d.css", nil))
+	expect(t, recorder.Header().Get("Cache-Control"), "public, max-age=31536000, immutable")
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/css/site.css", nil))
+	expect(t, recorder.Header().Get("Cache-Control"), "public, max-age=3600")
+	// 目录请求按实际返回的index.html匹配
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/", nil))
+	expect(t, recorder.Header().Get("Cache-Control"), "no-cache")
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/robots.txt", nil))
+	expect(t, recorder.Header().Get("Cache-Control"), "")
+}
+
+func TestStaticETag(t *testing.T) {
+	dir := newStaticDir(t, map[string]string{
+		"a.txt":     "same",
+		"b.txt":     "same",
+		"app.js":    "console.log(1)",
+		"app.js.gz": gzipString(t, "console.log(1)"),
+	})
+	defer os.RemoveAll(dir)
+	s := NewStatic(http.Dir(dir))
+	recorder := serveStatic(s, httptest.NewRequest("GET", "/a.txt", nil))
+	expect(t, recorder.Header().Get("ETag"), "")
+
+	s.ETag = true
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/a.txt", nil))
+	etag := recorder.Header().Get("ETag")
+	refute(t, etag, "")
+	expect(t, etag[0], byte('"'))
+	expect(t, recorder.Body.String(), "same")
+
+	// ETag只取决于内容
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/b.txt", nil))
+	expect(t, recorder.Header().Get("ETag"), etag)
+
+	req := httptest.NewRequest("GET", "/a.txt", nil)
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	recorder = serveStatic(s, req)
+	expect(t, recorder.Code, http.StatusNotModified)
+	expect(t, recorder.Body.Len(), 0)
+
+	req = httptest.NewRequest("GET", "/a.txt", nil)
+	req.Header.Set("If-None-Match", `"other"`)
+	recorder = serveStatic(s, req)
+	expect(t, recorder.Code, http.StatusOK)
+
+	// 内容变化后ETag随之变化
+	later := time.Now().Add(time.Hour)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filepath.Join(dir, "a.txt"), later, later)
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/a.txt", nil))
+	refute(t, recorder.Header().Get("ETag"), etag)
+	expect(t, recorder.Body.String(), "changed")
+
+	// 预压缩版本有自己的ETag
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/app.js", nil))
+	plain := recorder.Header().Get("ETag")
+	req = httptest.NewRequest("GET", "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	recorder = serveStatic(s, req)
+	expect(t, recorder.Header().Get("Content-Encoding"), "gzip")
+	refute(t, recorder.Header().Get("ETag"), plain)
+
+	s.ETag = false
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/b.txt", nil))
+	expect(t, recorder.Header().Get("ETag"), "")
+}
+
+func TestStaticETagLimits(t *testing.T) {
+	dir := newStaticDir(t, map[string]string{
+		"small.txt": "small",
+		"large.txt": strings.Repeat("x", 64),
+	})
+	defer os.RemoveAll(dir)
+	s := NewStatic(http.Dir(dir))
+	s.ETag = true
+	s.ETagMaxSize = 32
+
+	// 超过ETagMaxSize的文件只使用Last-Modified
+	recorder := serveStatic(s, httptest.NewRequest("GET", "/large.txt", nil))
+	expect(t, recorder.Header().Get("ETag"), "")
+	refute(t, recorder.Header().Get("Last-Modified"), "")
+
+	// Range请求不计算ETag，只使用已经缓存的
+	req := httptest.NewRequest("GET", "/small.txt", nil)
+	req.Header.Set("Range", "bytes=0-1")
+	recorder = serveStatic(s, req)
+	expect(t, recorder.Code, http.StatusPartialContent)
+	expect(t, recorder.Header().Get("ETag"), "")
+
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/small.txt", nil))
+	etag := recorder.Header().Get("ETag")
+	refute(t, etag, "")
+	recorder = serveStatic(s, req)
+	expect(t, recorder.Code, http.StatusPartialContent)
+	expect(t, recorder.Header().Get("ETag"), etag)
+	expect(t, recorder.Body.String(), "sm")
+}
@@ -0,0 +1,161 @@
+package negroni
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultStaticDeny 是NewStatic默认拒绝的文件，主要是编辑器和工具留下的备份文件
+var DefaultStaticDeny = []string{"*~", "*.bak", "*.swp", "*.orig", "*.old"}
+
+// errStaticDenied 表示路径被Static的规则拒绝
+var errStaticDenied = errors.New("negroni: static path denied")
+
+// matchStaticPattern 返回name是否匹配pattern。
+// pattern包含/时与完整路径及其上级目录比较，例如 "/private" 匹配 /private/a.txt；
+// 否则与路径中的每一段比较，例如 ".git" 匹配 /.git/config，"*.bak" 匹配 /db/dump.bak
+func matchStaticPattern(pattern, name string) bool {
+	if strings.Contains(pattern, "/") {
+		pattern = path.Clean("/" + pattern)
+		for p := name; ; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+			if p == "/" {
+				return false
+			}
+		}
+	}
+	for _, segment := range strings.Split(strings.Trim(name, "/"), "/") {
+		if ok, _ := path.Match(pattern, segment); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchStaticSegment 返回pattern是否匹配路径中的一段，prefix是从根目录到这一段的路径，
+// 例如 /.git/config 中 .git 这一段的prefix是 /.git。
+// pattern包含/时与prefix比较，否则与这一段的名字比较
+func matchStaticSegment(pattern, prefix string) bool {
+	if strings.Contains(pattern, "/") {
+		ok, _ := path.Match(path.Clean("/"+pattern), prefix)
+		return ok
+	}
+	ok, _ := path.Match(pattern, path.Base(prefix))
+	return ok
+}
+
+// denied 返回name是否被规则拒绝。逐段检查路径，以.开头的段或者匹配Deny的段会拒绝整个路径，
+// 除非Allow中有规则匹配同一段，例如 Allow "/.well-known" 不会放行 /.well-known/.git/config
+func (s *Static) denied(name string) bool {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return false
+	}
+	prefix := ""
+	for _, segment := range strings.Split(name[1:], "/") {
+		prefix += "/" + segment
+		if !s.deniedSegment(prefix) {
+			continue
+		}
+		allowed := false
+		for _, pattern := range s.Allow {
+			if matchStaticSegment(pattern, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// deniedSegment 返回prefix的最后一段是否被隐藏文件的限制或Deny拒绝
+func (s *Static) deniedSegment(prefix string) bool {
+	if !s.ShowHidden && strings.HasPrefix(path.Base(prefix), ".") {
+		return true
+	}
+	for _, pattern := range s.Deny {
+		if matchStaticSegment(pattern, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// open 按规则检查后打开name，被拒绝时返回errStaticDenied
+func (s *Static) open(name string) (http.File, error) {
+	if s.denied(name) {
+		return nil, errStaticDenied
+	}
+	if dir, ok := s.Dir.(http.Dir); ok && s.escapesDir(string(dir), name) {
+		return nil, errStaticDenied
+	}
+	return s.Dir.Open(name)
+}
+
+// escapesDir 返回name在root中解析符号链接后是否指向root之外，
+// 文件不存在时返回false，交给Open报告错误
+func (s *Static) escapesDir(root, name string) bool {
+	if root == "" {
+		root = "."
+	}
+	realRoot, err := s.root.get(root)
+	if err != nil {
+		return false
+	}
+	full := filepath.Join(root, filepath.FromSlash(path.Clean("/"+name)))
+	real, err := filepath.EvalSymlinks(full)
+	if err != nil {
+		return !os.IsNotExist(err)
+	}
+	real, err = filepath.Abs(real)
+	if err != nil {
+		return true
+	}
+	return real != realRoot && !strings.HasPrefix(real, realRoot+string(filepath.Separator))
+}
+
+// realRootCache 缓存根目录解析符号链接后的绝对路径，每个请求只需要解析请求的文件。
+// 根目录改变时重新解析，根目录本身是符号链接并且运行中被指向别处时需要重新创建Static
+type realRootCache struct {
+	mutex sync.Mutex
+	root  string
+	real  string
+}
+
+// get 返回root解析后的绝对路径，解析失败时不缓存
+func (c *realRootCache) get(root string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.real != "" && c.root == root {
+		return c.real, nil
+	}
+	real, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	real, err = filepath.Abs(real)
+	if err != nil {
+		return "", err
+	}
+	c.root, c.real = root, real
+	return real, nil
+}
+
+// serveDenied 处理被拒绝的请求，DenyStatus为0时交给下一个中间件
+func (s *Static) serveDenied(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if s.DenyStatus == 0 {
+		next(rw, r)
+		return
+	}
+	http.Error(rw, http.StatusText(s.DenyStatus), s.DenyStatus)
+}
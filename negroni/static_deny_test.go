@@ -0,0 +1,153 @@
+package negroni
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchStaticPattern(t *testing.T) {
+	expect(t, matchStaticPattern(".*", "/.git/config"), true)
+	expect(t, matchStaticPattern(".*", "/css/app.css"), false)
+	expect(t, matchStaticPattern("*.bak", "/db/dump.bak"), true)
+	expect(t, matchStaticPattern("node_modules", "/node_modules/x/index.js"), true)
+	expect(t, matchStaticPattern("/private", "/private/a.txt"), true)
+	expect(t, matchStaticPattern("/private", "/public/private"), false)
+	expect(t, matchStaticPattern("/docs/*.md", "/docs/a.md"), true)
+	expect(t, matchStaticPattern("/docs/*.md", "/a.md"), false)
+}
+
+func TestStaticDenyRules(t *testing.T) {
+	dir := newStaticDir(t, map[string]string{
+		"index.html":               "home",
+		".env":                     "SECRET=1",
+		".git/config":              "[core]",
+		".git/notes.txt":           "notes",
+		"config.php~":              "backup",
+		"db.bak":                   "backup",
+		"private/notes.txt":        "private",
+		".well-known/security.txt": "contact",
+		"css/app.css":              "body{}",
+	})
+	defer os.RemoveAll(dir)
+	s := NewStatic(http.Dir(dir))
+	// 修改s.Deny不影响DefaultStaticDeny
+	s.Deny[0] = "*.tilde"
+	expect(t, DefaultStaticDeny[0], "*~")
+	s.Deny[0] = "*~"
+	s.Deny = append(s.Deny, "/private")
+	s.Allow = []string{"/.well-known"}
+
+	for _, target := range []string{"/.env", "/.git/config", "/.git/", "/config.php~", "/db.bak", "/private/notes.txt", "/css/../.env"} {
+		recorder := serveStatic(s, httptest.NewRequest("GET", target, nil))
+		if recorder.Code != http.StatusTeapot {
+			t.Errorf("expected %s to go to next, got %d %q", target, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	recorder := serveStatic(s, httptest.NewRequest("GET", "/.well-known/security.txt", nil))
+	expect(t, recorder.Body.String(), "contact")
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/css/app.css", nil))
+	expect(t, recorder.Body.String(), "body{}")
+
+	s.DenyStatus = http.StatusNotFound
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/.env", nil))
+	expect(t, recorder.Code, http.StatusNotFound)
+	expect(t, strings.Contains(recorder.Body.String(), "SECRET"), false)
+
+	// 被拒绝的文件不出现在目录列表中
+	os.Remove(filepath.Join(dir, "index.html"))
+	s.Browse = true
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/", nil))
+	body := recorder.Body.String()
+	expect(t, strings.Contains(body, "css/"), true)
+	expect(t, strings.Contains(body, "db.bak"), false)
+	expect(t, strings.Contains(body, ".env"), false)
+	expect(t, strings.Contains(body, "private"), false)
+	expect(t, strings.Contains(body, ".well-known"), true)
+
+	// Allow只放行它匹配的那一段
+	s.Allow = []string{"/.well-known", "*.txt", "db.bak"}
+	for _, target := range []string{"/.git/notes.txt", "/private/notes.txt", "/.well-known/.git/config"} {
+		recorder = serveStatic(s, httptest.NewRequest("GET", target, nil))
+		expect(t, recorder.Code, http.StatusNotFound)
+	}
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/db.bak", nil))
+	expect(t, recorder.Body.String(), "backup")
+	s.Allow = []string{"/.well-known"}
+
+	// ShowHidden 允许访问隐藏文件，Deny仍然生效
+	s.ShowHidden = true
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/.env", nil))
+	expect(t, recorder.Body.String(), "SECRET=1")
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/db.bak", nil))
+	expect(t, recorder.Code, http.StatusNotFound)
+}
+
+func TestStaticTraversal(t *testing.T) {
+	parent, err := ioutil.TempDir("", "negroni-traversal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	root := filepath.Join(parent, "public")
+	os.MkdirAll(filepath.Join(root, "css"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "css", "app.css"), []byte("body{}"), 0644)
+	ioutil.WriteFile(filepath.Join(parent, "secret.txt"), []byte("secret"), 0644)
+	os.MkdirAll(filepath.Join(parent, "outside"), 0755)
+	ioutil.WriteFile(filepath.Join(parent, "outside", "a.txt"), []byte("secret"), 0644)
+
+	links := map[string]string{
+		filepath.Join(parent, "secret.txt"):   filepath.Join(root, "escape.txt"),
+		filepath.Join(parent, "outside"):      filepath.Join(root, "escape"),
+		"../secret.txt":                       filepath.Join(root, "relative.txt"),
+		filepath.Join(root, "css", "app.css"): filepath.Join(root, "inside.css"),
+	}
+	for target, link := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("symlinks not supported: %s", err)
+		}
+	}
+
+	s := NewStatic(http.Dir(root))
+	s.DenyStatus = http.StatusNotFound
+
+	for _, target := range []string{
+		"/../secret.txt",
+		"/css/../../secret.txt",
+		"/%2e%2e/secret.txt",
+		"/css/%2e%2e/%2e%2e/secret.txt",
+		"/..%2fsecret.txt",
+		"/escape.txt",
+		"/escape/a.txt",
+		"/escape/",
+		"/relative.txt",
+	} {
+		recorder := serveStatic(s, httptest.NewRequest("GET", target, nil))
+		if strings.Contains(recorder.Body.String(), "secret") {
+			t.Errorf("%s leaked a file outside the root", target)
+		}
+		if recorder.Code == http.StatusOK {
+			t.Errorf("expected %s to be rejected, got %d", target, recorder.Code)
+		}
+	}
+
+	// 指向根目录之内的符号链接照常返回
+	recorder := serveStatic(s, httptest.NewRequest("GET", "/inside.css", nil))
+	expect(t, recorder.Body.String(), "body{}")
+
+	// 根目录只解析一次，Dir改变后重新解析
+	realRoot, _ := filepath.EvalSymlinks(root)
+	realRoot, _ = filepath.Abs(realRoot)
+	expect(t, s.root.real, realRoot)
+	s.Dir = http.Dir(filepath.Join(root, "escape"))
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/a.txt", nil))
+	expect(t, recorder.Body.String(), "secret")
+	realOutside, _ := filepath.EvalSymlinks(filepath.Join(parent, "outside"))
+	realOutside, _ = filepath.Abs(realOutside)
+	expect(t, s.root.real, realOutside)
+}
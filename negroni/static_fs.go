@@ -0,0 +1,285 @@
+package negroni
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryFile 是内存文件系统中的一个文件
+type MemoryFile struct {
+	Data    []byte
+	ModTime time.Time
+}
+
+// MemoryFS 是基于内存的http.FileSystem，可以由NewMemoryFS、NewTarFS创建，
+// 也可以由cmd/bundle生成的代码创建，这样程序不需要磁盘上的文件就能提供静态资源
+type MemoryFS struct {
+	tree bundleTree
+}
+
+// NewMemoryFS 返回包含files的文件系统，key是以/分隔的文件路径，目录根据文件路径推导
+func NewMemoryFS(files map[string]MemoryFile) *MemoryFS {
+	fs := &MemoryFS{tree: newBundleTree()}
+	for name, file := range files {
+		data := file.Data
+		fs.tree.add(name, &bundleNode{
+			size:    int64(len(data)),
+			mode:    0444,
+			modTime: file.ModTime,
+			data:    func() ([]byte, error) { return data, nil },
+		})
+	}
+	return fs
+}
+
+// Open 实现http.FileSystem
+func (fs *MemoryFS) Open(name string) (http.File, error) {
+	return fs.tree.open(name)
+}
+
+// NewTarFS 把tar包中的普通文件和目录读入内存，r是gzip压缩的内容时会自动解压，
+// 符号链接等其他类型的条目会被忽略
+func NewTarFS(r io.Reader) (*MemoryFS, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	fs := &MemoryFS{tree: newBundleTree()}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			fs.tree.addDir(hdr.Name, hdr.ModTime)
+		case tar.TypeReg, tar.TypeRegA:
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			fs.tree.add(hdr.Name, &bundleNode{
+				size:    int64(len(data)),
+				mode:    os.FileMode(hdr.Mode).Perm(),
+				modTime: hdr.ModTime,
+				data:    func() ([]byte, error) { return data, nil },
+			})
+		}
+	}
+}
+
+// OpenTarFS 读取path指向的tar或tar.gz文件
+func OpenTarFS(path string) (*MemoryFS, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewTarFS(f)
+}
+
+// ZipFS 是基于zip包的http.FileSystem，文件在第一次打开时解压，解压后的内容缓存在内存中
+type ZipFS struct {
+	tree   bundleTree
+	closer io.Closer
+}
+
+// NewZipFS 返回基于r的文件系统
+func NewZipFS(r *zip.Reader) *ZipFS {
+	fs := &ZipFS{tree: newBundleTree()}
+	for _, f := range r.File {
+		if strings.HasSuffix(f.Name, "/") {
+			fs.tree.addDir(f.Name, f.Modified)
+			continue
+		}
+		fs.tree.add(f.Name, &bundleNode{
+			size:    int64(f.UncompressedSize64),
+			mode:    f.Mode().Perm(),
+			modTime: f.Modified,
+			data:    (&zipEntry{file: f}).data,
+		})
+	}
+	return fs
+}
+
+// zipEntry 解压zip包中的一个文件并缓存结果，解压失败时下次打开会重试
+type zipEntry struct {
+	file *zip.File
+
+	mutex sync.Mutex
+	bytes []byte
+}
+
+func (e *zipEntry) data() ([]byte, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.bytes != nil {
+		return e.bytes, nil
+	}
+	rc, err := e.file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	e.bytes = data
+	return data, nil
+}
+
+// OpenZipFS 打开path指向的zip文件，不再使用时需要调用Close
+func OpenZipFS(path string) (*ZipFS, error) {
+	rc, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	fs := NewZipFS(&rc.Reader)
+	fs.closer = rc
+	return fs, nil
+}
+
+// Open 实现http.FileSystem
+func (fs *ZipFS) Open(name string) (http.File, error) {
+	return fs.tree.open(name)
+}
+
+// Close 关闭OpenZipFS打开的文件
+func (fs *ZipFS) Close() error {
+	if fs.closer == nil {
+		return nil
+	}
+	return fs.closer.Close()
+}
+
+// bundleNode 是打包文件系统中的一个文件或目录，同时实现了os.FileInfo
+type bundleNode struct {
+	name     string
+	size     int64
+	mode     os.FileMode
+	modTime  time.Time
+	children []*bundleNode
+	data     func() ([]byte, error)
+}
+
+func (n *bundleNode) Name() string       { return n.name }
+func (n *bundleNode) Size() int64        { return n.size }
+func (n *bundleNode) Mode() os.FileMode  { return n.mode }
+func (n *bundleNode) ModTime() time.Time { return n.modTime }
+func (n *bundleNode) IsDir() bool        { return n.mode.IsDir() }
+func (n *bundleNode) Sys() interface{}   { return nil }
+
+// bundleTree 是以/开头的清理过的路径到节点的映射
+type bundleTree map[string]*bundleNode
+
+func newBundleTree() bundleTree {
+	return bundleTree{"/": {name: "/", mode: os.ModeDir | 0555}}
+}
+
+// add 添加一个文件，缺失的上级目录会被自动创建
+func (t bundleTree) add(name string, node *bundleNode) {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return
+	}
+	node.name = path.Base(name)
+	if old, ok := t[name]; ok {
+		// 同名条目以后出现的为准
+		*old = *node
+		return
+	}
+	t[name] = node
+	parent := t.addDir(path.Dir(name), time.Time{})
+	parent.children = append(parent.children, node)
+	sort.Slice(parent.children, func(i, j int) bool {
+		return parent.children[i].name < parent.children[j].name
+	})
+}
+
+// addDir 返回name对应的目录，不存在时创建，modTime不为零时更新目录的修改时间
+func (t bundleTree) addDir(name string, modTime time.Time) *bundleNode {
+	name = path.Clean("/" + name)
+	if dir, ok := t[name]; ok {
+		if !modTime.IsZero() {
+			dir.modTime = modTime
+		}
+		return dir
+	}
+	dir := &bundleNode{mode: os.ModeDir | 0555, modTime: modTime}
+	t.add(name, dir)
+	return dir
+}
+
+// open 打开name对应的文件或目录
+func (t bundleTree) open(name string) (http.File, error) {
+	node, ok := t[path.Clean("/"+name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if node.IsDir() {
+		return &bundleFile{Reader: bytes.NewReader(nil), node: node}, nil
+	}
+	data, err := node.data()
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &bundleFile{Reader: bytes.NewReader(data), node: node}, nil
+}
+
+// bundleFile 是打开的文件或目录
+type bundleFile struct {
+	*bytes.Reader
+	node   *bundleNode
+	offset int
+}
+
+func (f *bundleFile) Close() error { return nil }
+
+func (f *bundleFile) Stat() (os.FileInfo, error) { return f.node, nil }
+
+// Readdir 与os.File.Readdir的语义相同
+func (f *bundleFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.node.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: f.node.name, Err: os.ErrInvalid}
+	}
+	rest := f.node.children[f.offset:]
+	if count > 0 {
+		if len(rest) == 0 {
+			return nil, io.EOF
+		}
+		if count < len(rest) {
+			rest = rest[:count]
+		}
+	}
+	f.offset += len(rest)
+	infos := make([]os.FileInfo, len(rest))
+	for i, node := range rest {
+		infos[i] = node
+	}
+	return infos, nil
+}
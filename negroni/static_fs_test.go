@@ -0,0 +1,187 @@
+package negroni
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var bundleFiles = map[string]string{
+	"index.html":  "<h1>home</h1>",
+	"css/app.css": "body{}",
+	"js/app.js":   "console.log(1)",
+}
+
+func newTestZip(t *testing.T) *zip.Reader {
+	var buff bytes.Buffer
+	zw := zip.NewWriter(&buff)
+	for name, content := range bundleFiles {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buff.Bytes()), int64(buff.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func newTestTar(t *testing.T, compress bool) []byte {
+	var buff bytes.Buffer
+	var w io.Writer = &buff
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(&buff)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	tw.WriteHeader(&tar.Header{Name: "css/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: time.Unix(1000, 0)})
+	tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+	for name, content := range bundleFiles {
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content)), ModTime: time.Unix(1000, 0)})
+		io.WriteString(tw, content)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		gz.Close()
+	}
+	return buff.Bytes()
+}
+
+// checkBundleFS 检查fs中是否正好包含bundleFiles
+func checkBundleFS(t *testing.T, fs http.FileSystem) {
+	for name, content := range bundleFiles {
+		f, err := fs.Open("/" + name)
+		if err != nil {
+			t.Fatalf("open %s: %s", name, err)
+		}
+		data, _ := ioutil.ReadAll(f)
+		expect(t, string(data), content)
+		fi, _ := f.Stat()
+		expect(t, fi.Size(), int64(len(content)))
+		expect(t, fi.IsDir(), false)
+		f.Close()
+	}
+
+	root, err := fs.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := root.Readdir(-1)
+	expect(t, err, nil)
+	var names []string
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	expect(t, strings.Join(names, ","), "css,index.html,js")
+
+	dir, _ := fs.Open("css")
+	fi, _ := dir.Stat()
+	expect(t, fi.IsDir(), true)
+	infos, err = dir.Readdir(1)
+	expect(t, err, nil)
+	expect(t, len(infos), 1)
+	_, err = dir.Readdir(1)
+	expect(t, err, io.EOF)
+
+	_, err = fs.Open("/missing.txt")
+	expect(t, os.IsNotExist(err), true)
+}
+
+func TestMemoryFS(t *testing.T) {
+	files := make(map[string]MemoryFile)
+	for name, content := range bundleFiles {
+		files[name] = MemoryFile{Data: []byte(content), ModTime: time.Unix(1000, 0)}
+	}
+	fs := NewMemoryFS(files)
+	checkBundleFS(t, fs)
+
+	// ../不能越过根目录
+	f, err := fs.Open("/../css/../index.html")
+	expect(t, err, nil)
+	data, _ := ioutil.ReadAll(f)
+	expect(t, string(data), "<h1>home</h1>")
+}
+
+func TestZipFS(t *testing.T) {
+	checkBundleFS(t, NewZipFS(newTestZip(t)))
+}
+
+func TestZipFSCachesEntries(t *testing.T) {
+	dir := newStaticDir(t, nil)
+	defer os.RemoveAll(dir)
+	f, err := os.Create(filepath.Join(dir, "public.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("index.html")
+	io.WriteString(w, "<h1>home</h1>")
+	zw.Close()
+	f.Close()
+
+	fs, err := OpenZipFS(f.Name())
+	expect(t, err, nil)
+	_, err = fs.Open("/index.html")
+	expect(t, err, nil)
+
+	// 关闭zip文件后，已经解压过的文件仍然可以从缓存中读取
+	expect(t, fs.Close(), nil)
+	file, err := fs.Open("/index.html")
+	expect(t, err, nil)
+	data, _ := ioutil.ReadAll(file)
+	expect(t, string(data), "<h1>home</h1>")
+}
+
+func TestTarFS(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		fs, err := NewTarFS(bytes.NewReader(newTestTar(t, compress)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkBundleFS(t, fs)
+
+		dir, _ := fs.Open("/css")
+		fi, _ := dir.Stat()
+		expect(t, fi.ModTime().Equal(time.Unix(1000, 0)), true)
+		_, err = fs.Open("/link")
+		expect(t, os.IsNotExist(err), true)
+	}
+}
+
+func TestStaticServesZipFS(t *testing.T) {
+	s := NewStatic(NewZipFS(newTestZip(t)))
+
+	recorder := serveStatic(s, httptest.NewRequest("GET", "/css/app.css", nil))
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "body{}")
+	expect(t, recorder.Header().Get("Content-Type"), "text/css; charset=utf-8")
+
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/", nil))
+	expect(t, recorder.Body.String(), "<h1>home</h1>")
+
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/js", nil))
+	expect(t, recorder.Code, http.StatusFound)
+
+	s.Browse = true
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/js/", nil))
+	expect(t, strings.Contains(recorder.Body.String(), "app.js"), true)
+}
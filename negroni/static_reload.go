@@ -0,0 +1,248 @@
+package negroni
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLiveReloadPath 是浏览器订阅文件变化的SSE地址，位于Static的Prefix之下
+const DefaultLiveReloadPath = "/__livereload"
+
+// DefaultLiveReloadIgnore 是默认不监视的文件，规则格式与Static.Deny相同
+var DefaultLiveReloadIgnore = []string{".*", "*~", "*.swp", "*.tmp", "node_modules"}
+
+// LiveReloadOptions 是开发模式下自动刷新浏览器的配置，零值字段使用默认值
+type LiveReloadOptions struct {
+	// Path 是SSE的地址，默认为DefaultLiveReloadPath
+	Path string
+	// Interval 是检查文件修改时间的间隔，默认为500ms
+	Interval time.Duration
+	// Debounce 是发现变化后等待文件稳定的时间，这段时间内的多次修改只刷新一次，默认为100ms
+	Debounce time.Duration
+	// Ignore 是不监视的文件，默认为DefaultLiveReloadIgnore
+	Ignore []string
+}
+
+// NewDevStatic 返回一个适合本地开发的Static：监视directory中的文件，
+// 在返回的HTML页面中注入脚本，文件变化时通过Server-Sent Events让浏览器刷新。
+// 这个模式只能通过NewDevStatic开启，NewStatic返回的Static永远不会监视文件或修改页面
+func NewDevStatic(directory http.FileSystem, options LiveReloadOptions) *Static {
+	if options.Path == "" {
+		options.Path = DefaultLiveReloadPath
+	}
+	if options.Interval <= 0 {
+		options.Interval = 500 * time.Millisecond
+	}
+	if options.Debounce <= 0 {
+		options.Debounce = 100 * time.Millisecond
+	}
+	if options.Ignore == nil {
+		options.Ignore = DefaultLiveReloadIgnore
+	}
+
+	s := NewStatic(directory)
+	s.CachePolicies = []CachePolicy{{NoCache: true}}
+	s.reload = &liveReload{options: options, fs: directory}
+	return s
+}
+
+// liveReload 在有浏览器订阅时轮询文件的修改时间，变化时通知所有订阅者
+type liveReload struct {
+	options LiveReloadOptions
+	fs      http.FileSystem
+
+	mutex   sync.Mutex
+	clients map[chan struct{}]bool
+	stop    chan struct{}
+}
+
+// fileState 是轮询时记录的文件状态
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// subscribe 添加一个订阅者，第一个订阅者到来时开始轮询
+func (l *liveReload) subscribe() chan struct{} {
+	ch := make(chan struct{}, 1)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.clients == nil {
+		l.clients = make(map[chan struct{}]bool)
+	}
+	l.clients[ch] = true
+	if len(l.clients) == 1 {
+		l.stop = make(chan struct{})
+		go l.poll(l.stop)
+	}
+	return ch
+}
+
+// unsubscribe 移除一个订阅者，没有订阅者时停止轮询
+func (l *liveReload) unsubscribe(ch chan struct{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.clients, ch)
+	if len(l.clients) == 0 && l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+}
+
+// broadcast 通知所有订阅者，还没有处理上一次通知的订阅者不会重复收到
+func (l *liveReload) broadcast() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for ch := range l.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// poll 定期扫描文件，发现变化后等到Debounce时间内不再变化时通知订阅者
+func (l *liveReload) poll(stop chan struct{}) {
+	ticker := time.NewTicker(l.options.Interval)
+	defer ticker.Stop()
+
+	last := l.scan()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		current := l.scan()
+		if sameFileStates(last, current) {
+			continue
+		}
+		for {
+			last = current
+			select {
+			case <-stop:
+				return
+			case <-time.After(l.options.Debounce):
+			}
+			current = l.scan()
+			if sameFileStates(last, current) {
+				break
+			}
+		}
+		l.broadcast()
+	}
+}
+
+// scan 返回所有没有被忽略的文件的状态
+func (l *liveReload) scan() map[string]fileState {
+	states := make(map[string]fileState)
+	l.walk("/", states)
+	return states
+}
+
+func (l *liveReload) walk(dir string, states map[string]fileState) {
+	f, err := l.fs.Open(dir)
+	if err != nil {
+		return
+	}
+	infos, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return
+	}
+	for _, fi := range infos {
+		name := path.Join(dir, fi.Name())
+		if l.ignored(name) {
+			continue
+		}
+		if fi.IsDir() {
+			l.walk(name, states)
+			continue
+		}
+		states[name] = fileState{modTime: fi.ModTime(), size: fi.Size()}
+	}
+}
+
+func (l *liveReload) ignored(name string) bool {
+	for _, pattern := range l.options.Ignore {
+		if matchStaticPattern(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameFileStates(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, state := range a {
+		other, ok := b[name]
+		if !ok || other.size != state.size || !other.modTime.Equal(state.modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// serveEvents 保持SSE连接，文件变化时发送reload事件
+func (l *liveReload) serveEvents(rw http.ResponseWriter, r *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ch := l.subscribe()
+	defer l.unsubscribe(ch)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprint(rw, ": connected\n\n")
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ch:
+			fmt.Fprint(rw, "event: reload\ndata: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// liveReloadScript 返回注入页面的脚本，endpoint是SSE的完整地址
+func liveReloadScript(endpoint string) string {
+	return `<script>(function(){var es=new EventSource(` + strconv.Quote(endpoint) +
+		`);es.addEventListener("reload",function(){es.close();location.reload();});})();</script>`
+}
+
+// serveHTML 在页面的</body>之前注入刷新脚本后返回，没有</body>时追加到末尾
+func (l *liveReload) serveHTML(rw http.ResponseWriter, r *http.Request, endpoint, name string, f http.File, fi os.FileInfo) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		http.Error(rw, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	script := liveReloadScript(endpoint)
+	if i := bytes.LastIndex(bytes.ToLower(data), []byte("</body>")); i >= 0 {
+		data = append(data[:i:i], append([]byte(script), data[i:]...)...)
+	} else {
+		data = append(data, script...)
+	}
+	rw.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(rw, r, name, fi.ModTime(), bytes.NewReader(data))
+}
+
+// isHTMLFile 返回name是否是HTML页面
+func isHTMLFile(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".html" || ext == ".htm"
+}
@@ -0,0 +1,121 @@
+package negroni
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaticLiveReloadInjectsScript(t *testing.T) {
+	dir := newStaticDir(t, map[string]string{
+		"index.html":   "<html><BODY><h1>home</h1></BODY></html>",
+		"partial.html": "<p>partial</p>",
+		"app.js":       "js",
+	})
+	defer os.RemoveAll(dir)
+	s := NewDevStatic(http.Dir(dir), LiveReloadOptions{})
+	s.Prefix = "/ui"
+
+	recorder := serveStatic(s, httptest.NewRequest("GET", "/ui/", nil))
+	body := recorder.Body.String()
+	expect(t, strings.HasSuffix(body, "</script></BODY></html>"), true)
+	expect(t, strings.Contains(body, `new EventSource("/ui/__livereload")`), true)
+	expect(t, recorder.Header().Get("Cache-Control"), "no-cache")
+
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/ui/partial.html", nil))
+	expect(t, strings.HasPrefix(recorder.Body.String(), "<p>partial</p><script>"), true)
+
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/ui/app.js", nil))
+	expect(t, recorder.Body.String(), "js")
+
+	// NewStatic 不会注入脚本，也没有SSE地址
+	s = NewStatic(http.Dir(dir))
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/", nil))
+	expect(t, recorder.Body.String(), "<html><BODY><h1>home</h1></BODY></html>")
+	recorder = serveStatic(s, httptest.NewRequest("GET", DefaultLiveReloadPath, nil))
+	expect(t, recorder.Code, http.StatusTeapot)
+}
+
+func TestStaticLiveReloadEvents(t *testing.T) {
+	dir := newStaticDir(t, map[string]string{"index.html": "<h1>home</h1>", "css/app.css": "body{}"})
+	defer os.RemoveAll(dir)
+	s := NewDevStatic(http.Dir(dir), LiveReloadOptions{
+		Interval: 10 * time.Millisecond,
+		Debounce: 30 * time.Millisecond,
+		Ignore:   []string{"*.tmp"},
+	})
+	server := httptest.NewServer(New(s))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + DefaultLiveReloadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	expect(t, res.Header.Get("Content-Type"), "text/event-stream")
+
+	events := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "event: ") {
+				events <- strings.TrimPrefix(line, "event: ")
+			}
+		}
+		close(events)
+	}()
+	// 等待轮询开始并记录初始状态
+	time.Sleep(50 * time.Millisecond)
+
+	touch := func(name string, offset time.Duration) {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := ioutil.WriteFile(file, []byte(name+offset.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+		when := time.Now().Add(offset)
+		os.Chtimes(file, when, when)
+	}
+
+	// 被忽略的文件不会触发刷新
+	touch("draft.tmp", time.Hour)
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %q for ignored file", event)
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	// 连续的修改只触发一次刷新
+	touch("css/app.css", time.Hour)
+	touch("index.html", 2*time.Hour)
+	select {
+	case event := <-events:
+		expect(t, event, "reload")
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a reload event")
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected second event %q", event)
+	case <-time.After(150 * time.Millisecond):
+	}
+}
+
+func TestLiveReloadStopsPolling(t *testing.T) {
+	dir := newStaticDir(t, map[string]string{"a.txt": "a"})
+	defer os.RemoveAll(dir)
+	s := NewDevStatic(http.Dir(dir), LiveReloadOptions{Interval: 10 * time.Millisecond})
+
+	first := s.reload.subscribe()
+	second := s.reload.subscribe()
+	refute(t, s.reload.stop, nil)
+	s.reload.unsubscribe(first)
+	refute(t, s.reload.stop, nil)
+	s.reload.unsubscribe(second)
+	expect(t, s.reload.stop == nil, true)
+}
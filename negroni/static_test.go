@@ -0,0 +1,260 @@
+package negroni
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newStaticDir 创建一个包含给定文件的临时目录
+func newStaticDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "negroni-static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func gzipString(t *testing.T, s string) string {
+	var buff bytes.Buffer
+	gz := gzip.NewWriter(&buff)
+	gz.Write([]byte(s))
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buff.String()
+}
+
+// serveStatic 使用s处理请求，next被调用时返回418
+func serveStatic(s *Static, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	n := New(s)
+	n.UseHandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+	n.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestStaticServesFile(t *testing.T) {
+	dir := newStaticDir(t, map[string]string{"index.html": "<h1>home</h1>", "css/app.css": "body{}"})
+	defer os.RemoveAll(dir)
+	s := NewStatic(http.Dir(dir))
+
+	recorder := serveStatic(s, httptest.NewRequest("GET", "/css/app.css", nil))
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "body{}")
+
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/", nil))
+	expect(t, recorder.Body.String(), "<h1>home</h1>")
+
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/css", nil))
+	expect(t, recorder.Code, http.StatusFound)
+
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/missing.js", nil))
+	expect(t, recorder.Code, http.StatusTeapot)
+
+	recorder = serveStatic(s, httptest.NewRequest("POST", "/css/app.css", nil))
+	expect(t, recorder.Code, http.StatusTeapot)
+
+	s.Prefix = "/static"
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/static/css/app.css", nil))
+	expect(t, recorder.Body.String(), "body{}")
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/staticcss/app.css", nil))
+	expect(t, recorder.Code, http.StatusTeapot)
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	js := "console.log('hello world');"
+	dir := newStaticDir(t, map[string]string{
+		"app.js":    js,
+		"app.js.gz": gzipString(t, js),
+		"app.js.br": "fake brotli",
+		"plain.txt": "plain",
+	})
+	defer os.RemoveAll(dir)
+	s := NewStatic(http.Dir(dir))
+
+	req := httptest.NewRequest("GET", "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	recorder := serveStatic(s, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Header().Get("Content-Encoding"), "gzip")
+	expect(t, recorder.Header().Get("Vary"), "Accept-Encoding")
+	expect(t, recorder.Header().Get("Content-Type"), "text/javascript; charset=utf-8")
+	gz, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(gz)
+	expect(t, string(body), js)
+
+	// br优先于gzip
+	req = httptest.NewRequest("GET", "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	recorder = serveStatic(s, req)
+	expect(t, recorder.Header().Get("Content-Encoding"), "br")
+	expect(t, recorder.Body.String(), "fake brotli")
+
+	// q=0 表示拒绝
+	req = httptest.NewRequest("GET", "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "br;q=0, *")
+	recorder = serveStatic(s, req)
+	expect(t, recorder.Header().Get("Content-Encoding"), "gzip")
+
+	// 不接受编码时返回原文件
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/app.js", nil))
+	expect(t, recorder.Header().Get("Content-Encoding"), "")
+	expect(t, recorder.Body.String(), js)
+
+	// 没有预压缩文件时返回原文件
+	req = httptest.NewRequest("GET", "/plain.txt", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	recorder = serveStatic(s, req)
+	expect(t, recorder.Header().Get("Content-Encoding"), "")
+	expect(t, recorder.Body.String(), "plain")
+
+	// 修改一个Static的Encodings不影响DefaultStaticEncodings
+	s.Encodings[0] = StaticEncoding{Name: "zstd", Ext: ".zst"}
+	expect(t, DefaultStaticEncodings[0], StaticEncoding{Name: "br", Ext: ".br"})
+	expect(t, NewStatic(http.Dir(dir)).Encodings[0].Name, "br")
+}
+
+func TestStaticPrecompressedRange(t *testing.T) {
+	js := "0123456789"
+	dir := newStaticDir(t, map[string]string{"app.js": js, "app.js.gz": gzipString(t, js)})
+	defer os.RemoveAll(dir)
+
+	req := httptest.NewRequest("GET", "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=2-4")
+	recorder := serveStatic(NewStatic(http.Dir(dir)), req)
+	expect(t, recorder.Code, http.StatusPartialContent)
+	expect(t, recorder.Header().Get("Content-Encoding"), "")
+	expect(t, recorder.Body.String(), "234")
+}
+
+func TestStaticBrowse(t *testing.T) {
+	dir := newStaticDir(t, map[string]string{
+		"files/b.txt":         "bb",
+		"files/a.txt":         "aaaa",
+		"files/c <x>.txt":     "c",
+		"files/sub/inner.txt": "inner",
+		"files/.secret":       "hidden",
+	})
+	defer os.RemoveAll(dir)
+	s := NewStatic(http.Dir(dir))
+
+	// 默认不开启目录列表
+	recorder := serveStatic(s, httptest.NewRequest("GET", "/files/", nil))
+	expect(t, recorder.Code, http.StatusTeapot)
+
+	s.Browse = true
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/files/", nil))
+	body := recorder.Body.String()
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Header().Get("Content-Type"), "text/html; charset=utf-8")
+	expect(t, strings.Contains(body, `<a href="a.txt">a.txt</a>`), true)
+	expect(t, strings.Contains(body, `<a href="sub/">sub/</a>`), true)
+	expect(t, strings.Contains(body, `c &lt;x&gt;.txt`), true)
+	expect(t, strings.Contains(body, ".secret"), false)
+	expect(t, strings.Index(body, "sub/") < strings.Index(body, "a.txt"), true)
+	expect(t, strings.Index(body, "a.txt") < strings.Index(body, "b.txt"), true)
+
+	req := httptest.NewRequest("GET", "/files/?sort=size&order=desc", nil)
+	req.Header.Set("Accept", "application/json")
+	recorder = serveStatic(s, req)
+	expect(t, recorder.Header().Get("Content-Type"), "application/json; charset=utf-8")
+	var listing DirectoryListing
+	if err := json.Unmarshal(recorder.Body.Bytes(), &listing); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, listing.Sort, "size")
+	expect(t, len(listing.Entries), 4)
+	names := []string{}
+	for _, e := range listing.Entries {
+		names = append(names, e.Name)
+	}
+	expect(t, strings.Join(names, ","), "sub,a.txt,b.txt,c <x>.txt")
+
+	s.ShowHidden = true
+	recorder = serveStatic(s, req)
+	expect(t, strings.Contains(recorder.Body.String(), ".secret"), true)
+}
+
+func TestStaticBrowseWithPrefixAndIndex(t *testing.T) {
+	dir := newStaticDir(t, map[string]string{"docs/index.html": "docs home", "other/x.txt": "x"})
+	defer os.RemoveAll(dir)
+	s := NewStatic(http.Dir(dir))
+	s.Browse = true
+	s.Prefix = "/assets"
+
+	recorder := serveStatic(s, httptest.NewRequest("GET", "/assets/docs/", nil))
+	expect(t, recorder.Body.String(), "docs home")
+
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/assets/other/", nil))
+	expect(t, strings.Contains(recorder.Body.String(), "Index of /assets/other/"), true)
+
+	recorder = serveStatic(s, httptest.NewRequest("GET", "/other/", nil))
+	expect(t, recorder.Code, http.StatusTeapot)
+}
+
+func TestStaticFallback(t *testing.T) {
+	dir := newStaticDir(t, map[string]string{"index.html": "<app/>", "app.js": "js"})
+	defer os.RemoveAll(dir)
+	s := NewStatic(http.Dir(dir))
+	s.Fallback = "/index.html"
+	s.FallbackExclude = []string{"/api"}
+
+	newReq := func(method, target, accept string) *http.Request {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Accept", accept)
+		return req
+	}
+	html := "text/html,application/xhtml+xml,*/*;q=0.8"
+
+	recorder := serveStatic(s, newReq("GET", "/app/orders/42", html))
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "<app/>")
+	expect(t, recorder.Header().Get("Content-Type"), "text/html; charset=utf-8")
+
+	// 存在的文件照常返回
+	recorder = serveStatic(s, newReq("GET", "/app.js", html))
+	expect(t, recorder.Body.String(), "js")
+
+	for _, req := range []*http.Request{
+		newReq("GET", "/missing.js", html),
+		newReq("GET", "/api/orders", html),
+		newReq("GET", "/api", html),
+		newReq("GET", "/app/orders/42", "application/json"),
+		newReq("POST", "/app/orders/42", html),
+	} {
+		recorder = serveStatic(s, req)
+		if recorder.Code != http.StatusTeapot {
+			t.Errorf("expected %s %s to go to next, got %d", req.Method, req.URL, recorder.Code)
+		}
+	}
+
+	// 前缀之外的路径不受影响
+	s.Prefix = "/ui"
+	recorder = serveStatic(s, newReq("GET", "/ui/settings", html))
+	expect(t, recorder.Body.String(), "<app/>")
+	recorder = serveStatic(s, newReq("GET", "/settings", html))
+	expect(t, recorder.Code, http.StatusTeapot)
+}